@@ -0,0 +1,486 @@
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	fiberPackage   = protogen.GoImportPath("github.com/gofiber/fiber/v2")
+	ioPackage      = protogen.GoImportPath("io")
+	strconvPackage = protogen.GoImportPath("strconv")
+)
+
+// parseFunc returns the strconv call converting value to the kind of field and
+// the Go type the parsed value is converted to. Both are empty for kinds which
+// need no parsing.
+func parseFunc(g *protogen.GeneratedFile, field *protogen.Field, value string) (call string, goType string) {
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseBool")) + "(" + value + ")", ""
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseInt")) + "(" + value + ", 10, 32)", "int32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseInt")) + "(" + value + ", 10, 64)", ""
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseUint")) + "(" + value + ", 10, 32)", "uint32"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseUint")) + "(" + value + ", 10, 64)", ""
+	case protoreflect.FloatKind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseFloat")) + "(" + value + ", 32)", "float32"
+	case protoreflect.DoubleKind:
+		return g.QualifiedGoIdent(strconvPackage.Ident("ParseFloat")) + "(" + value + ", 64)", ""
+	}
+	return "", ""
+}
+
+// generateParse emits the conversion of the string variable value to the Go
+// type of field and its assignment to the field of x. failure emits the
+// statement handling a conversion error stored in err.
+func generateParse(g *protogen.GeneratedFile, field *protogen.Field, value string, failure func()) error {
+	if field.Desc.IsList() || field.Desc.IsMap() || field.Message != nil {
+		return fieldErrorf(field, "%s fields cannot be parsed from a string", fieldKind(field))
+	}
+	generateConvert(g, field, value, failure, func(expr string) {
+		switch {
+		case !field.Desc.HasOptionalKeyword() || field.Desc.Kind() == protoreflect.BytesKind:
+			g.P("x.", field.GoName, " = ", expr)
+		case expr == value || expr == "parsed":
+			g.P("x.", field.GoName, " = &", expr)
+		default:
+			g.P("converted := ", expr)
+			g.P("x.", field.GoName, " = &converted")
+		}
+	})
+	return nil
+}
+
+// generateParseList is generateParse for the elements of a list field, which
+// are appended to the field of x.
+func generateParseList(g *protogen.GeneratedFile, field *protogen.Field, value string, failure func()) error {
+	if !field.Desc.IsList() || field.Message != nil {
+		return fieldErrorf(field, "%s fields cannot be parsed from strings", fieldKind(field))
+	}
+	generateConvert(g, field, value, failure, func(expr string) {
+		g.P("x.", field.GoName, " = append(x.", field.GoName, ", ", expr, ")")
+	})
+	return nil
+}
+
+// generateConvert emits the conversion of the string variable value to the Go
+// type of the values of field and calls assign with the converted expression.
+func generateConvert(g *protogen.GeneratedFile, field *protogen.Field, value string, failure func(), assign func(expr string)) {
+	switch field.Desc.Kind() {
+	case protoreflect.StringKind:
+		assign(value)
+		return
+	case protoreflect.BytesKind:
+		assign("[]byte(" + value + ")")
+		return
+	case protoreflect.EnumKind:
+		// Enums are accepted by name or by number.
+		values := g.QualifiedGoIdent(protogen.GoIdent{GoName: field.Enum.GoIdent.GoName + "_value", GoImportPath: field.Enum.GoIdent.GoImportPath})
+		g.P("parsed, ok := ", values, "[", value, "]")
+		g.P("if !ok {")
+		g.P("number, err := ", strconvPackage.Ident("ParseInt"), "(", value, ", 10, 32)")
+		g.P("if err != nil {")
+		failure()
+		g.P("}")
+		g.P("parsed = int32(number)")
+		g.P("}")
+		assign(g.QualifiedGoIdent(field.Enum.GoIdent) + "(parsed)")
+		return
+	}
+
+	call, goType := parseFunc(g, field, value)
+	g.P("parsed, err := ", call)
+	g.P("if err != nil {")
+	failure()
+	g.P("}")
+	if goType != "" {
+		assign(goType + "(parsed)")
+	} else {
+		assign("parsed")
+	}
+}
+
+// goType returns the Go type of the values of field, the type of the element
+// for lists and the pointed type for scalars with the optional keyword.
+func goType(g *protogen.GeneratedFile, field *protogen.Field) string {
+	if field.Desc.IsMap() {
+		return "map[" + goType(g, field.Message.Fields[0]) + "]" + goType(g, field.Message.Fields[1])
+	}
+	var elem string
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		elem = "bool"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		elem = "int32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		elem = "int64"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		elem = "uint32"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		elem = "uint64"
+	case protoreflect.FloatKind:
+		elem = "float32"
+	case protoreflect.DoubleKind:
+		elem = "float64"
+	case protoreflect.StringKind:
+		elem = "string"
+	case protoreflect.BytesKind:
+		elem = "[]byte"
+	case protoreflect.EnumKind:
+		elem = g.QualifiedGoIdent(field.Enum.GoIdent)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		elem = "*" + g.QualifiedGoIdent(field.Message.GoIdent)
+	}
+	if field.Desc.IsList() {
+		return "[]" + elem
+	}
+	return elem
+}
+
+// generateLocal emits the binding of field from the request local named name,
+// looked up by the Go expression lookup. A local of another type than the
+// field is reported as an error.
+func generateLocal(g *protogen.GeneratedFile, field *protogen.Field, name, lookup string) {
+	typ := goType(g, field)
+	g.P("if value := ", lookup, "; value != nil {")
+	g.P("local, ok := value.(", typ, ")")
+	g.P("if !ok {")
+	g.P("return ", fmtPackage.Ident("Errorf"), "(\"context value ", name, " is %T, want ", typ, "\", value)")
+	g.P("}")
+	if field.Desc.HasOptionalKeyword() && field.Message == nil {
+		g.P("x.", field.GoName, " = &local")
+	} else {
+		g.P("x.", field.GoName, " = local")
+	}
+	g.P("}")
+}
+
+// fiberReaders maps the sources of string parameters to the Fiber context
+// methods reading them.
+var fiberReaders = map[string]string{
+	sourcePath:     "Params",
+	sourceHeader:   "Get",
+	sourceCookie:   "Cookies",
+	sourceFormData: "FormValue",
+	sourceQuery:    "Query",
+}
+
+// generateFiberParam emits the binding of field from the string returned by the
+// Fiber context method read, e.g. Params, for the parameter named param.
+// Conversion errors are returned as 400 Bad Request errors naming the param.
+func generateFiberParam(g *protogen.GeneratedFile, field *protogen.Field, source, read, param string) error {
+	g.P("if value := ctx.", read, "(\"", param, "\"); value != \"\" {")
+	err := generateParse(g, field, "value", func() {
+		g.P("return ", fiberPackage.Ident("NewError"), "(", fiberPackage.Ident("StatusBadRequest"), ", \"invalid ", source, " parameter ", param, ": \"+err.Error())")
+	})
+	g.P("}")
+	return err
+}
+
+// siblingField returns the string field of the message of field named name.
+func siblingField(field *protogen.Field, name string) (*protogen.Field, error) {
+	for _, sibling := range field.Parent.Fields {
+		if string(sibling.Desc.Name()) == name {
+			if sibling.Desc.Kind() != protoreflect.StringKind || sibling.Desc.IsList() || sibling.Desc.HasOptionalKeyword() {
+				return nil, fieldErrorf(field, "%s must be a string field", name)
+			}
+			return sibling, nil
+		}
+	}
+	return nil, fieldErrorf(field, "no field %s in %s", name, field.Parent.Desc.Name())
+}
+
+// uploadSiblings returns the fields receiving the name and the content type of
+// the file uploaded into field, as named by its field option.
+func uploadSiblings(field *protogen.Field) (filename, mime *protogen.Field, err error) {
+	option := fieldOption(field)
+	if option.FilenameField != nil {
+		if filename, err = siblingField(field, option.GetFilenameField()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if option.MimeField != nil {
+		if mime, err = siblingField(field, option.GetMimeField()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return filename, mime, nil
+}
+
+// isUploadSibling reports whether field receives the name or the content type
+// of a file uploaded into another field of its message.
+func isUploadSibling(field *protogen.Field) bool {
+	for _, upload := range field.Parent.Fields {
+		if !isUpload(upload) {
+			continue
+		}
+		if filename, mime, _ := uploadSiblings(upload); field == filename || field == mime {
+			return true
+		}
+	}
+	return false
+}
+
+// readsUploadHeader reports whether generateUpload reads the multipart header
+// of the file uploaded into field, to check its size or store its name or
+// content type.
+func readsUploadHeader(field *protogen.Field) bool {
+	filename, mime, _ := uploadSiblings(field)
+	return fieldOption(field).GetMaxSize() > 0 || filename != nil || mime != nil
+}
+
+// generateUpload emits the binding of the bytes field from the open uploaded
+// file and its multipart header. The size of the file is checked against the
+// max_size of the field option, tooLarge emitting the rejection, and its name
+// and content type are stored in the fields named by filename_field and
+// mime_field.
+func generateUpload(g *protogen.GeneratedFile, field *protogen.Field, tooLarge func(limit int64)) error {
+	filename, mime, err := uploadSiblings(field)
+	if err != nil {
+		return err
+	}
+	if limit := fieldOption(field).GetMaxSize(); limit > 0 {
+		g.P("if header.Size > ", limit, " {")
+		tooLarge(limit)
+		g.P("}")
+	}
+	g.P("data, err := ", ioPackage.Ident("ReadAll"), "(file)")
+	g.P("if err != nil {")
+	g.P("return err")
+	g.P("}")
+	g.P("x.", field.GoName, " = data")
+	if filename != nil {
+		g.P("x.", filename.GoName, " = header.Filename")
+	}
+	if mime != nil {
+		g.P("x.", mime.GoName, " = header.Header.Get(\"Content-Type\")")
+	}
+	return nil
+}
+
+// generateFiberFile emits the binding of the bytes field from the file uploaded
+// in the multipart form field named param.
+func generateFiberFile(g *protogen.GeneratedFile, field *protogen.Field, param string) error {
+	g.P("if header, err := ctx.FormFile(\"", param, "\"); err == nil {")
+	g.P("file, err := header.Open()")
+	g.P("if err != nil {")
+	g.P("return err")
+	g.P("}")
+	g.P("defer file.Close()")
+	err := generateUpload(g, field, func(limit int64) {
+		g.P("return ", fiberPackage.Ident("NewError"), "(", fiberPackage.Ident("StatusRequestEntityTooLarge"), ", \"file ", param, " exceeds ", limit, " bytes\")")
+	})
+	g.P("}")
+	return err
+}
+
+// httpBinding is the binding of the fields of a request derived from the
+// google.api.http rules of the methods taking it.
+type httpBinding struct {
+	// path holds the names of the fields bound from path template variables.
+	path map[string]bool
+	// body is "*" when the fields not bound from the path are read from the
+	// body, or the name of the field holding the whole body.
+	body string
+}
+
+// source returns the source of field under the binding. Fields which are
+// neither bound from the path nor the body are read from the query.
+func (b *httpBinding) source(field *protogen.Field) string {
+	name := string(field.Desc.Name())
+	switch {
+	case b.path[name]:
+		return sourcePath
+	case b.body == "*" || b.body == name:
+		return sourceBody
+	}
+	return sourceQuery
+}
+
+// requestMethods maps the messages of the files of the plugin to the methods
+// of all its files taking them, as indexed by indexRequestMethods, so that the
+// google.api.http rules of a service apply to requests declared in another
+// file.
+var requestMethods = map[protoreflect.MessageDescriptor][]protoreflect.MethodDescriptor{}
+
+// indexRequestMethods records the methods of the files of gen in
+// requestMethods.
+func indexRequestMethods(gen *protogen.Plugin) {
+	for _, file := range gen.Files {
+		for _, service := range file.Services {
+			for _, method := range service.Methods {
+				requests := requestMethods[method.Desc.Input()]
+				if !containsMethod(requests, method.Desc) {
+					requestMethods[method.Desc.Input()] = append(requests, method.Desc)
+				}
+			}
+		}
+	}
+}
+
+func containsMethod(methods []protoreflect.MethodDescriptor, method protoreflect.MethodDescriptor) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// messageMethods returns the methods taking msg, those of its own file when
+// the methods of the plugin have not been indexed.
+func messageMethods(msg *protogen.Message) []protoreflect.MethodDescriptor {
+	if methods, ok := requestMethods[msg.Desc]; ok {
+		return methods
+	}
+	var methods []protoreflect.MethodDescriptor
+	services := msg.Desc.ParentFile().Services()
+	for i := 0; i < services.Len(); i++ {
+		serviceMethods := services.Get(i).Methods()
+		for j := 0; j < serviceMethods.Len(); j++ {
+			if method := serviceMethods.Get(j); method.Input().FullName() == msg.Desc.FullName() {
+				methods = append(methods, method)
+			}
+		}
+	}
+	return methods
+}
+
+// messageHTTPBinding returns the binding of msg derived from the google.api.http
+// rules, additional bindings included, of the methods taking msg in any file of
+// the plugin, or nil if there are none. The path variables of all rules are
+// bound, while the rules must agree on the body.
+func messageHTTPBinding(msg *protogen.Message) (*httpBinding, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	var binding *httpBinding
+	for _, method := range messageMethods(msg) {
+		rule, err := methodHTTPRule(method)
+		if err != nil {
+			return nil, messageErrorf(msg, "google.api.http rule of %s: %v", method.FullName(), err)
+		}
+		if rule == nil {
+			continue
+		}
+		if binding == nil {
+			binding = &httpBinding{path: map[string]bool{}, body: rule.body}
+		}
+		for _, rule := range append([]*httpRule{rule}, rule.bindings...) {
+			if rule.body != binding.body {
+				return nil, messageErrorf(msg, "google.api.http rules of %s disagree on the body", method.FullName())
+			}
+			names, _, err := templateVariables(rule.path, func(name string) (string, error) { return name, nil })
+			if err != nil {
+				return nil, messageErrorf(msg, "google.api.http rule of %s: %v", method.FullName(), err)
+			}
+			for _, name := range names {
+				binding.path[name] = true
+			}
+		}
+	}
+	if binding == nil {
+		return nil, nil
+	}
+	for name := range binding.path {
+		if msg.Desc.Fields().ByName(protoreflect.Name(name)) == nil {
+			return nil, messageErrorf(msg, "google.api.http path variable %s is not a field", name)
+		}
+	}
+	if binding.body != "" && binding.body != "*" && msg.Desc.Fields().ByName(protoreflect.Name(binding.body)) == nil {
+		return nil, messageErrorf(msg, "google.api.http body %s is not a field", binding.body)
+	}
+	return binding, nil
+}
+
+// isHTTPBody reports whether field holds the whole body of its request as
+// named by the body of a google.api.http rule.
+func isHTTPBody(field *protogen.Field) bool {
+	binding, _ := messageHTTPBinding(field.Parent)
+	return binding != nil && binding.body == string(field.Desc.Name()) && fieldSource(field) == sourceBody
+}
+
+// generateFiberBody emits the binding of the body to field, which holds the
+// whole body of its request.
+func generateFiberBody(g *protogen.GeneratedFile, field *protogen.Field) {
+	target := "&x." + field.GoName
+	if field.Message != nil && !field.Desc.IsList() && !field.Desc.IsMap() {
+		g.P("x.", field.GoName, " = new(", field.Message.GoIdent, ")")
+		target = "x." + field.GoName
+	}
+	g.P("if err := ctx.BodyParser(", target, "); err != nil {")
+	generateFiberParserError(g, "body")
+	g.P("}")
+}
+
+// generateFiberParserError emits the return of the error err of QueryParser or
+// BodyParser, which parse the part of the request named part, as a 400 Bad
+// Request error. The errors of Fiber, such as the 422 of an unsupported content
+// type, keep their status.
+func generateFiberParserError(g *protogen.GeneratedFile, part string) {
+	g.P("var fiberErr *", fiberPackage.Ident("Error"))
+	g.P("if ", errorsPackage.Ident("As"), "(err, &fiberErr) {")
+	g.P("return err")
+	g.P("}")
+	g.P("return ", fiberPackage.Ident("NewError"), "(", fiberPackage.Ident("StatusBadRequest"), ", \"invalid ", part, ": \"+err.Error())")
+}
+
+// isUpload reports whether field is bound from a file uploaded in a multipart
+// form.
+func isUpload(field *protogen.Field) bool {
+	return fieldSource(field) == sourceFormData && field.Desc.Kind() == protoreflect.BytesKind && !field.Desc.IsList()
+}
+
+// generateFiberBinder emits the BindFromFiber method of msg binding a Fiber
+// request from the sources of its fields. A malformed request is rejected with
+// a 400 Bad Request error.
+func generateFiberBinder(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message) {
+	g.P("func (x *", msg.GoIdent, ") BindFromFiber(ctx *", g.QualifiedGoIdent(fiberPackage.Ident("Ctx")), ") error {")
+	if len(msg.Fields) > 0 {
+		g.P("if err := ctx.QueryParser(x); err != nil {")
+		generateFiberParserError(g, "query")
+		g.P("}")
+		if hasBodyParams(msg.Fields) {
+			g.P("if err := ctx.BodyParser(x); err != nil {")
+			generateFiberParserError(g, "body")
+			g.P("}")
+		}
+	}
+	if _, err := messageHTTPBinding(msg); err != nil {
+		gen.Error(err)
+	}
+	for _, field := range msg.Fields {
+		if isHTTPBody(field) {
+			generateFiberBody(g, field)
+			continue
+		}
+		source, name := fieldBinding(field)
+		if source == sourceContext {
+			generateLocal(g, field, name, "ctx.Locals(\""+name+"\")")
+			continue
+		}
+		read, ok := fiberReaders[source]
+		if !ok {
+			continue
+		}
+		if source == sourceQuery && (field.Desc.IsList() || field.Desc.IsMap() || field.Message != nil) {
+			// Left to QueryParser.
+			continue
+		}
+		var err error
+		if isUpload(field) {
+			err = generateFiberFile(g, field, name)
+		} else {
+			err = generateFiberParam(g, field, source, read, name)
+		}
+		if err != nil {
+			gen.Error(err)
+		}
+	}
+	g.P("return nil")
+	g.P("}")
+}
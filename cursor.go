@@ -0,0 +1,136 @@
+package main
+
+import (
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
+)
+
+const base64Package = protogen.GoImportPath("encoding/base64")
+
+// cursorField returns the string cursor field of a request paged by cursor.
+func cursorField(msg *protogen.Message) *protogen.Field {
+	for _, field := range msg.Fields {
+		if field.Desc.Name() == "cursor" && field.Desc.Kind() == protoreflect.StringKind && !field.Desc.IsList() {
+			return field
+		}
+	}
+	return nil
+}
+
+// cursorSort returns the name of the generated variable holding the sort of a
+// request paged by cursor. The cursor stores the values of its keys.
+func cursorSort(msg *protogen.Message) string {
+	return "_" + msg.GoIdent.GoName + "_cursorSort"
+}
+
+// checkCursor reports why msg cannot be paged by cursor, if it cannot.
+func checkCursor(msg *protogen.Message, parser *common.ParserOption) error {
+	switch limit, _ := pagingFields(msg); {
+	case parser.Paging:
+		return messageErrorf(msg, "paging and cursor cannot be combined")
+	case len(parser.GetSortable()) > 0:
+		return messageErrorf(msg, "a request paged by cursor cannot have sortable fields")
+	case cursorField(msg) == nil || limit == nil:
+		return messageErrorf(msg, "cursor needs a string cursor field and an integer limit field")
+	}
+	return nil
+}
+
+// generateCursorFilter adds to the query of GetFilter the condition selecting
+// the documents which follow the cursor in the sort order. Validate rejects an
+// invalid cursor; one which was not validated matches no documents, rather
+// than restarting from the first page.
+func generateCursorFilter(g *protogen.GeneratedFile, msg *protogen.Message) {
+	field := cursorField(msg)
+	g.P("if x.Get", field.GoName, "() != \"\" {")
+	g.P("after, err := x.cursorValues()")
+	g.P("if err != nil {")
+	g.P("// The cursor is invalid, which Validate reports.")
+	g.P("query[\"$expr\"] = false")
+	g.P("} else {")
+	g.P("or := ", bsonPackage.Ident("A"), "{}")
+	g.P("for i, value := range after {")
+	g.P("cond := ", bsonPackage.Ident("M"), "{}")
+	g.P("for _, previous := range after[:i] {")
+	g.P("cond[previous.Key] = previous.Value")
+	g.P("}")
+	g.P("operator := \"$gt\"")
+	g.P("if ", cursorSort(msg), "[i].Value.(int) < 0 {")
+	g.P("operator = \"$lt\"")
+	g.P("}")
+	g.P("cond[value.Key] = ", bsonPackage.Ident("M"), "{operator: value.Value}")
+	g.P("or = append(or, cond)")
+	g.P("}")
+	g.P("query[\"$or\"] = or")
+	g.P("}")
+	g.P("}")
+}
+
+func generateCursor(g *protogen.GeneratedFile, msg *protogen.Message, sort []sortKey) {
+	field := cursorField(msg)
+	document := sortDocument(g, sort)
+
+	g.P()
+	g.P("var ", cursorSort(msg), " = ", document)
+	g.P()
+	g.P("// cursorValues decodes the sort key values stored in the cursor.")
+	g.P("func (x *", msg.GoIdent, ") cursorValues() (", bsonPackage.Ident("D"), ", error) {")
+	g.P("data, err := ", base64Package.Ident("RawURLEncoding"), ".DecodeString(x.Get", field.GoName, "())")
+	g.P("if err != nil {")
+	g.P("return nil, err")
+	g.P("}")
+	g.P("var values ", bsonPackage.Ident("D"))
+	g.P("if err := ", bsonPackage.Ident("Unmarshal"), "(data, &values); err != nil {")
+	g.P("return nil, err")
+	g.P("}")
+	g.P("if len(values) != len(", cursorSort(msg), ") {")
+	g.P("return nil, ", errorsPackage.Ident("New"), "(\"cursor does not match the sort\")")
+	g.P("}")
+	g.P("for i, value := range values {")
+	g.P("if value.Key != ", cursorSort(msg), "[i].Key {")
+	g.P("return nil, ", errorsPackage.Ident("New"), "(\"cursor does not match the sort\")")
+	g.P("}")
+	g.P("}")
+	g.P("return values, nil")
+	g.P("}")
+	g.P()
+	g.P("// NextCursor returns the cursor of the page following the page ending with")
+	g.P("// last, the last document of a page fetched with GetFilter and GetOptions.")
+	g.P("// last must hold the sort keys under their document names: a bson.Raw, a")
+	g.P("// bson.M or bson.D, or an entity with bson tags. A proto message does not do,")
+	g.P("// as bson marshals its fields under their lowercased Go names.")
+	g.P("func (x *", msg.GoIdent, ") NextCursor(last interface{}) (string, error) {")
+	g.P("raw, ok := last.(", bsonPackage.Ident("Raw"), ")")
+	g.P("if !ok {")
+	g.P("data, err := ", bsonPackage.Ident("Marshal"), "(last)")
+	g.P("if err != nil {")
+	g.P("return \"\", err")
+	g.P("}")
+	g.P("raw = data")
+	g.P("}")
+	g.P("values := make(", bsonPackage.Ident("D"), ", 0, len(", cursorSort(msg), "))")
+	g.P("for _, key := range ", cursorSort(msg), " {")
+	g.P("value, err := raw.LookupErr(", stringsPackage.Ident("Split"), "(key.Key, \".\")...)")
+	g.P("if err != nil {")
+	g.P("return \"\", ", fmtPackage.Ident("Errorf"), "(\"cursor key %s: %w\", key.Key, err)")
+	g.P("}")
+	g.P("values = append(values, ", bsonPackage.Ident("E"), "{Key: key.Key, Value: value})")
+	g.P("}")
+	g.P("data, err := ", bsonPackage.Ident("Marshal"), "(values)")
+	g.P("if err != nil {")
+	g.P("return \"\", err")
+	g.P("}")
+	g.P("return ", base64Package.Ident("RawURLEncoding"), ".EncodeToString(data), nil")
+	g.P("}")
+}
+
+// cursorRule returns the validate rule checking the cursor field of a request
+// paged by cursor.
+func cursorRule(field *protogen.Field) []validateRule {
+	if field.Parent == nil || !parserOption(field.Parent).Cursor || cursorField(field.Parent) != field {
+		return nil
+	}
+	return []validateRule{{name: "cursor"}}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// directive is a @name:"value" directive of a comment.
+type directive struct {
+	name  string
+	value string
+}
+
+// directives holds the directives of a message, field or method in the order
+// of their comments.
+type directives []directive
+
+// legacyFlags are the directives which may also be written without the @ and
+// the quotes, as in paging:true.
+var legacyFlags = map[string]bool{
+	"paging": true,
+	"cursor": true,
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// foreignDirectives are the @name: words of other tools, which the plugin
+// leaves to them, such as the @gotags: of protoc-go-inject-tag.
+var foreignDirectives = map[string]bool{
+	"gotags": true,
+}
+
+// parseDirectives returns the directives of comment. A directive starts with an
+// @ which does not follow a word, as in an e-mail address, and its name must
+// be followed by a colon and a quoted value. An @ word without a colon, such
+// as @deprecated, is plain text, and so are foreign directives.
+func parseDirectives(comment string) (directives, error) {
+	var parsed directives
+	for i := 0; i < len(comment); {
+		c := comment[i]
+		if c != '@' && !isIdentByte(c) || i > 0 && isIdentByte(comment[i-1]) {
+			i++
+			continue
+		}
+		start := i
+		if c == '@' {
+			start++
+		}
+		end := start
+		for end < len(comment) && isIdentByte(comment[end]) {
+			end++
+		}
+		name := comment[start:end]
+		switch {
+		case c != '@':
+			// Words are plain text, except for legacy flags as in paging:true.
+			if legacyFlags[name] && strings.HasPrefix(comment[end:], ":") {
+				valueEnd := end + 1
+				for valueEnd < len(comment) && isIdentByte(comment[valueEnd]) {
+					valueEnd++
+				}
+				if valueEnd > end+1 {
+					parsed = append(parsed, directive{name: name, value: comment[end+1 : valueEnd]})
+					end = valueEnd
+				}
+			}
+		case name == "" || !strings.HasPrefix(comment[end:], ":") || foreignDirectives[name]:
+		case !strings.HasPrefix(comment[end+1:], "\""):
+			return nil, fmt.Errorf("directive @%s: value must be quoted", name)
+		default:
+			closing := strings.IndexByte(comment[end+2:], '"')
+			if closing < 0 {
+				return nil, fmt.Errorf("directive @%s: unterminated value", name)
+			}
+			parsed = append(parsed, directive{name: name, value: comment[end+2 : end+2+closing]})
+			end += 2 + closing + 1
+		}
+		if end <= i {
+			end = i + 1
+		}
+		i = end
+	}
+	return parsed, nil
+}
+
+// commentDirectives returns the directives of the leading and trailing comments
+// of comments, ignoring malformed ones, which checkDirectives reports.
+func commentDirectives(comments protogen.CommentSet) directives {
+	var all directives
+	for _, comment := range []protogen.Comments{comments.Leading, comments.Trailing} {
+		parsed, _ := parseDirectives(string(comment))
+		all = append(all, parsed...)
+	}
+	return all
+}
+
+// values returns the values of the directives named name.
+func (d directives) values(name string) []string {
+	var values []string
+	for _, directive := range d {
+		if directive.name == name {
+			values = append(values, directive.value)
+		}
+	}
+	return values
+}
+
+// value returns the value of the first directive named name.
+func (d directives) value(name string) (string, bool) {
+	for _, directive := range d {
+		if directive.name == name {
+			return directive.value, true
+		}
+	}
+	return "", false
+}
+
+// has reports whether d holds the directive name with value.
+func (d directives) has(name, value string) bool {
+	for _, v := range d.values(name) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveCheck validates the value of a directive.
+type directiveCheck func(value string) error
+
+func oneOf(allowed ...string) directiveCheck {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func nonEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+func anyValue(string) error {
+	return nil
+}
+
+func checkSort(value string) error {
+	_, err := parseSort(value)
+	return err
+}
+
+// parseLimit parses the page limits of a @limit:"default=20,max=100"
+// directive, leaving a limit which is not set zero.
+func parseLimit(value string) (defaultLimit, maxLimit int64, err error) {
+	for _, setting := range strings.Split(value, ",") {
+		name, number, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		limit, err := strconv.ParseInt(number, 10, 64)
+		if name != "default" && name != "max" {
+			return 0, 0, fmt.Errorf("unknown setting %q, want default or max", name)
+		}
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("%s must be a positive integer", name)
+		}
+		if name == "default" {
+			defaultLimit = limit
+		} else {
+			maxLimit = limit
+		}
+	}
+	return defaultLimit, maxLimit, nil
+}
+
+func checkLimit(value string) error {
+	_, _, err := parseLimit(value)
+	return err
+}
+
+func checkMerge(value string) error {
+	request, target, ok := strings.Cut(value, "|")
+	if !ok || request == "" || target == "" {
+		return fmt.Errorf("must be Request|Target")
+	}
+	return nil
+}
+
+func checkFeature(value string) error {
+	if !strings.HasPrefix(value, "keeper=") || value == "keeper=" {
+		return fmt.Errorf("must be keeper=<transit key>")
+	}
+	return nil
+}
+
+func checkFilter(value string) error {
+	if value != "filter" && !strings.HasPrefix(value, "filter,") {
+		return fmt.Errorf("must be filter with optional settings")
+	}
+	return nil
+}
+
+func checkRoute(value string) error {
+	if routeMethod, path, ok := strings.Cut(value, " "); !ok || routeMethod == "" || !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("must be an HTTP method and a path, as in GET /items/:id")
+	}
+	return nil
+}
+
+// The directives understood on messages, fields and methods.
+var (
+	messageDirectiveChecks = map[string]directiveCheck{
+		"parser":                   oneOf("fiber", "swag", "swag-response", "list"),
+		"paging":                   oneOf("true", "false"),
+		"cursor":                   oneOf("true", "false"),
+		"sort":                     checkSort,
+		"sortable":                 nonEmpty,
+		"limit":                    checkLimit,
+		"projection":               nonEmpty,
+		"merge":                    checkMerge,
+		"pickFrom":                 nonEmpty,
+		"pickFromArrayWPagination": nonEmpty,
+		"feature":                  checkFeature,
+	}
+	fieldDirectiveChecks = map[string]directiveCheck{
+		"parser": checkFilter,
+		// The transit key, or empty for the key of the message.
+		"encrypted": anyValue,
+	}
+	methodDirectiveChecks = map[string]directiveCheck{
+		"route": checkRoute,
+	}
+)
+
+// isDirective reports whether name is a directive of messages, fields or
+// methods.
+func isDirective(name string) bool {
+	for _, checks := range []map[string]directiveCheck{messageDirectiveChecks, fieldDirectiveChecks, methodDirectiveChecks} {
+		if _, ok := checks[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkComments reports the first malformed, unknown or misplaced directive of
+// comments, as validated by checks.
+func checkComments(comments protogen.CommentSet, checks map[string]directiveCheck) error {
+	for _, comment := range []protogen.Comments{comments.Leading, comments.Trailing} {
+		parsed, err := parseDirectives(string(comment))
+		if err != nil {
+			return err
+		}
+		for _, directive := range parsed {
+			check, ok := checks[directive.name]
+			if !ok && !isDirective(directive.name) {
+				return fmt.Errorf("unknown directive @%s", directive.name)
+			}
+			if !ok {
+				return fmt.Errorf("directive @%s does not apply here", directive.name)
+			}
+			if err := check(directive.value); err != nil {
+				return fmt.Errorf("directive @%s:%q: %v", directive.name, directive.value, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDirectives reports the malformed, unknown and misplaced directives of
+// the messages, fields and methods of file.
+func checkDirectives(gen *protogen.Plugin, file *protogen.File) {
+	checkMessageDirectives(gen, file.Messages)
+	for _, service := range file.Services {
+		for _, method := range service.Methods {
+			if err := checkComments(method.Comments, methodDirectiveChecks); err != nil {
+				gen.Error(fmt.Errorf("%s: method %s: %v", file.Desc.Path(), method.Desc.FullName(), err))
+			}
+		}
+	}
+}
+
+// checkMessageDirectives reports the directives of messages and of their
+// fields and nested messages, as checkDirectives does.
+func checkMessageDirectives(gen *protogen.Plugin, messages []*protogen.Message) {
+	for _, msg := range messages {
+		if err := checkComments(msg.Comments, messageDirectiveChecks); err != nil {
+			gen.Error(messageErrorf(msg, "%v", err))
+		}
+		for _, field := range msg.Fields {
+			if err := checkComments(field.Comments, fieldDirectiveChecks); err != nil {
+				gen.Error(fieldErrorf(field, "%v", err))
+			}
+		}
+		checkMessageDirectives(gen, msg.Messages)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
+)
+
+// filter describes how a request field takes part in the Mongo filter built by
+// GetFilter. It is declared by a @parser:"filter" leading comment with optional
+// op and field settings, e.g. @parser:"filter,op=gte,field=created_at".
+type filter struct {
+	field *protogen.Field
+	key   string
+	op    string
+}
+
+// filterOperators maps the supported filter operators to Mongo query operators.
+var filterOperators = map[string]string{
+	"eq":     "",
+	"ne":     "$ne",
+	"gt":     "$gt",
+	"gte":    "$gte",
+	"lt":     "$lt",
+	"lte":    "$lte",
+	"in":     "$in",
+	"nin":    "$nin",
+	"regex":  "$regex",
+	"prefix": "$regex",
+	"exists": "$exists",
+}
+
+// parseFilter returns the filter declared for field, or nil when the field is
+// not part of the filter.
+func parseFilter(field *protogen.Field) (*filter, error) {
+	var settings string
+	for _, parser := range commentDirectives(field.Comments).values("parser") {
+		if parser == "filter" || strings.HasPrefix(parser, "filter,") {
+			settings = parser
+			break
+		}
+	}
+	if settings == "" {
+		return nil, nil
+	}
+	f := &filter{field: field, key: string(field.Desc.Name()), op: "eq"}
+	for _, setting := range strings.Split(settings, ",")[1:] {
+		if setting = strings.TrimSpace(setting); setting == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(setting, "=")
+		switch name {
+		case "op":
+			if _, ok := filterOperators[value]; !ok {
+				return nil, fieldErrorf(field, "unknown filter operator %q", value)
+			}
+			f.op = value
+		case "field":
+			if value == "" {
+				return nil, fieldErrorf(field, "empty filter field")
+			}
+			f.key = value
+		default:
+			return nil, fieldErrorf(field, "unknown filter setting %q", setting)
+		}
+	}
+	return f, nil
+}
+
+// filterValue returns the value of field used in a Mongo filter and the
+// condition under which the field takes part in the filter.
+func filterValue(g *protogen.GeneratedFile, field *protogen.Field) (cond string, value string, err error) {
+	getter := "x.Get" + field.GoName + "()"
+	switch {
+	case field.Desc.IsMap(), field.Desc.IsList() && field.Message != nil, field.Message != nil && !isWrapper(field.Message):
+		return "", "", fieldErrorf(field, "%s fields cannot be used in a filter", fieldKind(field))
+	case field.Desc.IsList():
+		return nonZeroCheck(field, "x"), g.QualifiedGoIdent(bsonPackage.Ident("M")) + "{\"$in\": " + getter + "}", nil
+	case field.Message != nil:
+		return nonZeroCheck(field, "x"), getter + ".GetValue()", nil
+	case field.Desc.HasOptionalKeyword():
+		return nonZeroCheck(field, "x"), "*x." + field.GoName, nil
+	}
+	return nonZeroCheck(field, "x"), getter, nil
+}
+
+// operand returns the value compared by the Mongo operator of f and the
+// condition under which f takes part in the filter.
+func (f *filter) operand(g *protogen.GeneratedFile) (cond string, value string, err error) {
+	field := f.field
+	list := field.Desc.IsList() && !field.Desc.IsMap()
+	switch f.op {
+	case "in", "nin":
+		if !list || field.Message != nil {
+			return "", "", fieldErrorf(field, "filter operator %s needs a repeated scalar field", f.op)
+		}
+		return nonZeroCheck(field, "x"), "x.Get" + field.GoName + "()", nil
+	case "eq":
+		return filterValue(g, field)
+	}
+	if list {
+		return "", "", fieldErrorf(field, "filter operator %s cannot be used with repeated fields", f.op)
+	}
+	cond, value, err = filterValue(g, field)
+	if err != nil {
+		return "", "", err
+	}
+	kind := field.Desc.Kind()
+	if field.Message != nil {
+		kind = field.Message.Fields[0].Desc.Kind()
+	}
+	switch f.op {
+	case "regex", "prefix":
+		if kind != protoreflect.StringKind {
+			return "", "", fieldErrorf(field, "filter operator %s needs a string field", f.op)
+		}
+		if f.op == "prefix" {
+			value = "\"^\" + " + g.QualifiedGoIdent(regexpPackage.Ident("QuoteMeta")) + "(" + value + ")"
+		}
+	case "exists":
+		if kind != protoreflect.BoolKind {
+			return "", "", fieldErrorf(field, "filter operator %s needs a bool field", f.op)
+		}
+	}
+	return cond, value, nil
+}
+
+func generateFilter(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message, parser *common.ParserOption) {
+	var keys []string
+	filters := map[string][]*filter{}
+	for _, field := range msg.Fields {
+		f, err := parseFilter(field)
+		if err != nil {
+			gen.Error(err)
+			return
+		}
+		if f == nil {
+			continue
+		}
+		if _, ok := filters[f.key]; !ok {
+			keys = append(keys, f.key)
+		}
+		filters[f.key] = append(filters[f.key], f)
+	}
+
+	g.P("func (x *", msg.GoIdent, ") GetFilter() ", bsonPackage.Ident("M"), " {")
+	g.P("query := ", bsonPackage.Ident("M"), "{}")
+	for i, key := range keys {
+		if f := filters[key][0]; len(filters[key]) == 1 {
+			cond, value, err := f.operand(g)
+			if err != nil {
+				gen.Error(err)
+				return
+			}
+			if f.op != "eq" {
+				value = g.QualifiedGoIdent(bsonPackage.Ident("M")) + "{" + strconv.Quote(filterOperators[f.op]) + ": " + value + "}"
+			}
+			g.P("if ", cond, " {")
+			g.P("query[", strconv.Quote(key), "] = ", value)
+			g.P("}")
+			continue
+		}
+
+		// Several fields share the key, so their operators are collected
+		// into a single document, e.g. {"$gte": from, "$lte": to}. The
+		// index of the key tells apart the variables of keys of the same
+		// camel case, such as created_at and createdAt.
+		variable := Camel(key) + "Filter" + strconv.Itoa(i)
+		g.P(variable, " := ", bsonPackage.Ident("M"), "{}")
+		operators := map[string]bool{}
+		for _, f := range filters[key] {
+			if f.op == "eq" || operators[filterOperators[f.op]] {
+				gen.Error(fieldErrorf(f.field, "filter on %s repeats or mixes operator %s", key, f.op))
+				return
+			}
+			operators[filterOperators[f.op]] = true
+			cond, value, err := f.operand(g)
+			if err != nil {
+				gen.Error(err)
+				return
+			}
+			g.P("if ", cond, " {")
+			g.P(variable, "[", strconv.Quote(filterOperators[f.op]), "] = ", value)
+			g.P("}")
+		}
+		g.P("if len(", variable, ") > 0 {")
+		g.P("query[", strconv.Quote(key), "] = ", variable)
+		g.P("}")
+	}
+	if parser.Cursor && checkCursor(msg, parser) == nil {
+		generateCursorFilter(g, msg)
+	}
+	g.P("return query")
+	g.P("}")
+}
@@ -0,0 +1,1334 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// The tests in this file compile protos, run the plugin over them and build
+// the generated code in a scratch module, where a test written against the
+// generated code checks its behavior. They need the go command and the modules
+// required by scratchGoMod, from the module cache or the module proxy, and are
+// skipped when these are not available.
+
+const scratchModule = "example.com/scratch"
+
+// scratchHeader starts the protos of the scratch tests, which are compiled to
+// the package example.com/scratch/api.
+const scratchHeader = `syntax = "proto3";
+
+package scratch;
+
+import "common.proto";
+
+option go_package = "example.com/scratch/api";
+`
+
+const scratchGoMod = `module example.com/scratch
+
+go 1.18
+
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/goccy/go-json v0.10.0
+	github.com/gofiber/fiber/v2 v2.40.0
+	go.mongodb.org/mongo-driver v1.11.0
+	google.golang.org/genproto/googleapis/api v0.0.0-20240903143218-8af14fe29dc1
+	google.golang.org/grpc v1.68.1
+	google.golang.org/protobuf v1.34.2
+)
+`
+
+// scratchDeps imports the packages the generated code may import, so that
+// go mod tidy records all of them in go.sum.
+const scratchDeps = `package scratch
+
+import (
+	_ "github.com/goccy/go-json"
+	_ "github.com/gofiber/fiber/v2"
+	_ "go.mongodb.org/mongo-driver/bson"
+	_ "go.mongodb.org/mongo-driver/mongo/options"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/status"
+
+	_ "gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
+	_ "gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/validation"
+)
+`
+
+// scratchProtoc compiles the protos named by its arguments, found in the
+// directories of its -I flags, and writes the CodeGeneratorRequest generating
+// them to its output. The google/api protos, such as annotations.proto, are
+// those compiled into the googleapis packages.
+const scratchProtoc = `package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bufbuild/protocompile"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func main() {
+	paths := flag.String("I", ".", "import paths, separated as in PATH")
+	flag.Parse()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(protocompile.CompositeResolver{
+			&protocompile.SourceResolver{ImportPaths: filepath.SplitList(*paths)},
+			protocompile.ResolverFunc(func(path string) (protocompile.SearchResult, error) {
+				file, err := protoregistry.GlobalFiles.FindFileByPath(path)
+				return protocompile.SearchResult{Desc: file}, err
+			}),
+		}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(context.Background(), flag.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	req := &pluginpb.CodeGeneratorRequest{FileToGenerate: flag.Args()}
+	seen := map[string]bool{}
+	var add func(file protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		for i := 0; i < file.Imports().Len(); i++ {
+			add(file.Imports().Get(i).FileDescriptor)
+		}
+		req.ProtoFile = append(req.ProtoFile, protodesc.ToFileDescriptorProto(file))
+	}
+	for _, file := range files {
+		add(file)
+	}
+	out, err := proto.Marshal(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
+`
+
+// scratch is the module shared by the scratch tests, holding the go.mod and
+// go.sum of their modules and the scratchProtoc binary.
+var scratch struct {
+	once sync.Once
+	dir  string
+	env  []string
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if scratch.dir != "" {
+		os.RemoveAll(scratch.dir)
+	}
+	os.Exit(code)
+}
+
+// goCommand runs the go command with args in dir.
+func goCommand(dir string, args ...string) error {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = scratch.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.New(string(out))
+	}
+	return nil
+}
+
+func setupScratch() error {
+	module, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("go", "env", "GOMODCACHE", "GOPROXY").Output()
+	if err != nil {
+		return err
+	}
+	env := strings.Fields(string(out))
+	if len(env) != 2 {
+		return errors.New("go env: unexpected output")
+	}
+	// The modules are taken from the module cache first, to build offline.
+	scratch.env = append(os.Environ(),
+		"GOPROXY=file://"+filepath.ToSlash(filepath.Join(env[0], "cache", "download"))+","+env[1],
+		"GOFLAGS=-mod=mod",
+		"GOSUMDB=off",
+		"GOWORK=off",
+	)
+	if scratch.dir, err = os.MkdirTemp("", "scratch"); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"go.mod":             scratchGoMod + "\nreplace gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers => " + module + "\n",
+		"deps.go":            scratchDeps,
+		"cmd/protoc/main.go": scratchProtoc,
+	}
+	if err := writeFiles(scratch.dir, files); err != nil {
+		return err
+	}
+	if err := goCommand(scratch.dir, "mod", "tidy"); err != nil {
+		return err
+	}
+	return goCommand(scratch.dir, "build", "-o", "protoc", "./cmd/protoc")
+}
+
+// writeFiles writes files, named by their path in dir.
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needScratch skips t unless the scratch module can be set up.
+func needScratch(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds generated code")
+	}
+	scratch.once.Do(func() {
+		scratch.err = setupScratch()
+	})
+	if scratch.err != nil {
+		t.Skipf("scratch module unavailable: %v", scratch.err)
+	}
+}
+
+// generateScratch compiles protos, named by their file name, and runs the
+// plugin with opts and protoc-gen-go over them. It returns the generated files
+// named by their path in the scratch module, or the error of the plugin.
+func generateScratch(t *testing.T, protos map[string]string, opts settings) (map[string]string, error) {
+	t.Helper()
+	needScratch(t)
+	dir := t.TempDir()
+	if err := writeFiles(dir, protos); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range protos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	common, err := filepath.Abs("common")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(filepath.Join(scratch.dir, "protoc"), append([]string{"-I", dir + string(filepath.ListSeparator) + common}, names...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("compile protos: %v\n%s", err, stderr.String())
+	}
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(out, req); err != nil {
+		t.Fatal(err)
+	}
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range gen.Files {
+		if file.Generate {
+			internal_gengo.GenerateFile(gen, file)
+			generateHelpers(gen, file, opts)
+		}
+	}
+	resp := gen.Response()
+	if resp.Error != nil {
+		return nil, errors.New(resp.GetError())
+	}
+	files := map[string]string{}
+	for _, file := range resp.File {
+		files[strings.TrimPrefix(file.GetName(), scratchModule+"/")] = file.GetContent()
+	}
+	return files, nil
+}
+
+// buildScratch writes files, named by their path, in a new scratch module and
+// runs go vet and go test in it.
+func buildScratch(t *testing.T, files map[string]string) {
+	t.Helper()
+	needScratch(t)
+	dir := t.TempDir()
+	for _, name := range []string{"go.mod", "go.sum"} {
+		content, err := os.ReadFile(filepath.Join(scratch.dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(content)
+	}
+	if err := writeFiles(dir, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := goCommand(dir, "vet", "./..."); err != nil {
+		t.Fatalf("go vet:\n%v", err)
+	}
+	if err := goCommand(dir, "test", "./..."); err != nil {
+		t.Fatalf("go test:\n%v", err)
+	}
+}
+
+// testScratch generates the code of the proto of the api package with opts and
+// builds it along with files, such as a test of the generated code.
+func testScratch(t *testing.T, proto string, opts settings, files map[string]string) {
+	t.Helper()
+	generated, err := generateScratch(t, map[string]string{"api.proto": scratchHeader + proto}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		generated[name] = content
+	}
+	buildScratch(t, generated)
+}
+
+// scratchSettings are the settings of the scratch tests, with the packages
+// resolved in the scratch module and the common package of the plugin.
+func scratchSettings() settings {
+	return settings{
+		pkgs:        newPackages(scratchModule, "", "gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common", ""),
+		fiberBinder: true,
+	}
+}
+
+func TestGeneratedFilterKinds(t *testing.T) {
+	testScratch(t, `
+import "google/protobuf/wrappers.proto";
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_ACTIVE = 1;
+}
+
+// @parser:"list"
+message ListItemsRequest {
+  // @parser:"filter"
+  string name = 1;
+  // @parser:"filter"
+  int64 count = 2;
+  // @parser:"filter"
+  bool active = 3;
+  // @parser:"filter"
+  double score = 4;
+  // @parser:"filter"
+  Status status = 5;
+  // @parser:"filter"
+  bytes digest = 6;
+  // @parser:"filter"
+  optional uint32 level = 7;
+  // @parser:"filter"
+  optional bool archived = 8;
+  // @parser:"filter"
+  repeated string tags = 9;
+  // @parser:"filter"
+  google.protobuf.StringValue owner = 10;
+  string search = 11;
+}
+`, scratchSettings(), map[string]string{"api/filter_test.go": `package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestGetFilter(t *testing.T) {
+	if got := (&ListItemsRequest{Search: "x"}).GetFilter(); len(got) != 0 {
+		t.Errorf("GetFilter() of unset fields = %v, want an empty filter", got)
+	}
+
+	level, archived := uint32(0), false
+	req := &ListItemsRequest{
+		Name:     "name",
+		Count:    2,
+		Active:   true,
+		Score:    1.5,
+		Status:   Status_STATUS_ACTIVE,
+		Digest:   []byte{1},
+		Level:    &level,
+		Archived: &archived,
+		Tags:     []string{"a", "b"},
+		Owner:    wrapperspb.String(""),
+	}
+	want := bson.M{
+		"name":     "name",
+		"count":    int64(2),
+		"active":   true,
+		"score":    1.5,
+		"status":   Status_STATUS_ACTIVE,
+		"digest":   []byte{1},
+		"level":    uint32(0),
+		"archived": false,
+		"tags":     bson.M{"$in": []string{"a", "b"}},
+		"owner":    "",
+	}
+	if got := req.GetFilter(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilter() = %v, want %v", got, want)
+	}
+}
+`})
+}
+
+func TestGeneratedFilterOperators(t *testing.T) {
+	testScratch(t, `
+// @parser:"list"
+message ListOrdersRequest {
+  // @parser:"filter,op=gte,field=created_at"
+  int64 created_from = 1;
+  // @parser:"filter,op=lt,field=created_at"
+  int64 created_to = 2;
+  // @parser:"filter,op=ne,field=state"
+  string not_state = 3;
+  // @parser:"filter,op=prefix,field=name"
+  string name_prefix = 4;
+  // @parser:"filter,op=regex"
+  string title = 5;
+  // @parser:"filter,op=nin,field=tags"
+  repeated string without_tags = 6;
+  // @parser:"filter,op=exists,field=deleted_at"
+  optional bool deleted = 7;
+  // @parser:"filter,op=gte,field=createdAt"
+  int64 legacy_from = 8;
+  // @parser:"filter,op=lte,field=createdAt"
+  int64 legacy_to = 9;
+}
+`, scratchSettings(), map[string]string{"api/filter_test.go": `package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetFilter(t *testing.T) {
+	deleted := false
+	tests := []struct {
+		req  *ListOrdersRequest
+		want bson.M
+	}{
+		{&ListOrdersRequest{}, bson.M{}},
+		{&ListOrdersRequest{CreatedFrom: 10}, bson.M{"created_at": bson.M{"$gte": int64(10)}}},
+		{
+			&ListOrdersRequest{CreatedFrom: 10, CreatedTo: 20},
+			bson.M{"created_at": bson.M{"$gte": int64(10), "$lt": int64(20)}},
+		},
+		{
+			&ListOrdersRequest{NotState: "closed", NamePrefix: "a.b", Title: "^x"},
+			bson.M{
+				"state": bson.M{"$ne": "closed"},
+				"name":  bson.M{"$regex": "^a\\.b"},
+				"title": bson.M{"$regex": "^x"},
+			},
+		},
+		{
+			&ListOrdersRequest{WithoutTags: []string{"a"}, Deleted: &deleted},
+			bson.M{"tags": bson.M{"$nin": []string{"a"}}, "deleted_at": bson.M{"$exists": false}},
+		},
+		{
+			&ListOrdersRequest{CreatedFrom: 10, LegacyFrom: 1, LegacyTo: 2},
+			bson.M{"created_at": bson.M{"$gte": int64(10)}, "createdAt": bson.M{"$gte": int64(1), "$lte": int64(2)}},
+		},
+	}
+	for _, test := range tests {
+		if got := test.req.GetFilter(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetFilter() of %v = %v, want %v", test.req, got, test.want)
+		}
+	}
+}
+`})
+}
+
+func TestGeneratedPaging(t *testing.T) {
+	testScratch(t, `
+// @parser:"list" paging:true @limit:"default=10,max=50" @sort:"created_at:desc"
+message ListItemsRequest {
+  int32 limit = 1;
+  int64 skip = 2;
+}
+`, scratchSettings(), map[string]string{"api/paging_test.go": `package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetOptions(t *testing.T) {
+	tests := []struct {
+		req         *ListItemsRequest
+		limit, skip int64
+	}{
+		{&ListItemsRequest{}, 10, 0},
+		{&ListItemsRequest{Limit: 20, Skip: 40}, 20, 40},
+		{&ListItemsRequest{Limit: 1000000, Skip: -5}, 50, 0},
+		{&ListItemsRequest{Limit: -1}, 10, 0},
+	}
+	for _, test := range tests {
+		options := test.req.GetOptions()
+		if *options.Limit != test.limit || *options.Skip != test.skip {
+			t.Errorf("GetOptions() of %v has limit %d and skip %d, want %d and %d", test.req, *options.Limit, *options.Skip, test.limit, test.skip)
+		}
+		want := bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}
+		if !reflect.DeepEqual(options.Sort, want) {
+			t.Errorf("GetOptions() of %v sorts by %v, want %v", test.req, options.Sort, want)
+		}
+		pagination := test.req.GetPagination(99)
+		if pagination.Limit != test.limit || pagination.Skip != test.skip || pagination.TotalItems != 99 {
+			t.Errorf("GetPagination(99) of %v = %v", test.req, pagination)
+		}
+	}
+}
+`})
+}
+
+func TestGeneratedCursor(t *testing.T) {
+	testScratch(t, `
+// @parser:"list" cursor:true @sort:"created_at:desc" @limit:"default=2"
+message ListItemsRequest {
+  string cursor = 1;
+  int32 limit = 2;
+  // @parser:"filter"
+  string owner = 3;
+}
+`, scratchSettings(), map[string]string{"api/cursor_test.go": `package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCursor(t *testing.T) {
+	options := (&ListItemsRequest{}).GetOptions()
+	sort := bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}
+	if *options.Limit != 2 || !reflect.DeepEqual(options.Sort, sort) {
+		t.Errorf("GetOptions() has limit %d and sort %v, want 2 and %v", *options.Limit, options.Sort, sort)
+	}
+
+	cursor, err := (&ListItemsRequest{}).NextCursor(bson.M{"_id": int32(7), "created_at": int64(100), "name": "last"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ListItemsRequest{Cursor: cursor, Owner: "owner"}
+	if err := req.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	want := bson.M{
+		"owner": "owner",
+		"$or": bson.A{
+			bson.M{"created_at": bson.M{"$lt": int64(100)}},
+			bson.M{"created_at": int64(100), "_id": bson.M{"$gt": int32(7)}},
+		},
+	}
+	if got := req.GetFilter(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilter() = %v, want %v", got, want)
+	}
+
+	if _, err := (&ListItemsRequest{}).NextCursor(bson.M{"_id": 1}); err == nil {
+		t.Error("NextCursor() of a document without created_at succeeded")
+	}
+
+	invalid := &ListItemsRequest{Cursor: "invalid"}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() of an invalid cursor succeeded")
+	}
+	if got, want := invalid.GetFilter(), (bson.M{"$expr": false}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilter() of an invalid cursor = %v, want %v", got, want)
+	}
+}
+`})
+}
+
+func TestGeneratedProjection(t *testing.T) {
+	testScratch(t, `
+message Item {
+  string id = 1;
+  string name = 2;
+  int64 created_at = 3;
+  int64 updated_at = 4;
+  string secret = 5;
+}
+
+message ItemView {
+  string name = 1;
+  int64 created_at = 2;
+}
+
+// @pickFromArrayWPagination:"Item"
+message ListItemsResponse {
+  repeated ItemView items = 1;
+  Pagination pagination = 2;
+}
+
+// @parser:"list" @projection:"ListItemsResponse"
+message ListItemsRequest {}
+
+// @parser:"list" cursor:true @sort:"updated_at:desc" @projection:"ItemView"
+message ScrollItemsRequest {
+  string cursor = 1;
+  int32 limit = 2;
+}
+`, scratchSettings(), map[string]string{"api/projection_test.go": `package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProjection(t *testing.T) {
+	req := &ListItemsRequest{}
+	want := bson.M{"name": 1, "created_at": 1}
+	if got := req.GetProjection(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetProjection() = %v, want %v", got, want)
+	}
+	if got := req.GetOptions().Projection; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetOptions() projects %v, want %v", got, want)
+	}
+
+	// The cursor reads the sort keys from the fetched documents.
+	want = bson.M{"name": 1, "created_at": 1, "updated_at": 1}
+	if got := (&ScrollItemsRequest{}).GetOptions().Projection; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetOptions() projects %v, want %v", got, want)
+	}
+}
+`})
+}
+
+func TestGeneratedValidate(t *testing.T) {
+	testScratch(t, `
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+}
+
+message CreateItemRequest {
+  string name = 1 [(field_option) = {validate: "min=3,pattern=^[a-z]+$"}];
+  string code = 2 [(field_option) = {validate: "required,len=4"}];
+  string id = 3 [(field_option) = {validate: "uuid"}];
+  int32 count = 4 [(field_option) = {validate: "gt=1,in=2|3"}];
+  Color color = 5 [(field_option) = {validate: "in=COLOR_RED"}];
+  repeated string tags = 6 [(field_option) = {validate: "min=2"}];
+  // required: true
+  bool accepted = 7;
+}
+`, scratchSettings(), map[string]string{"api/validate_test.go": `package api
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		req  *CreateItemRequest
+		want string
+	}{
+		{&CreateItemRequest{Code: "abcd", Accepted: true}, ""},
+		{
+			&CreateItemRequest{Name: "ab", Code: "abcd", Id: "x", Count: 1, Color: Color_COLOR_UNSPECIFIED, Tags: []string{"a"}, Accepted: true},
+			"name: length must be at least 3; id: must be a UUID; count: must be greater than 1; count: must be one of 2, 3; tags: length must be at least 2",
+		},
+		{&CreateItemRequest{Name: "AbC", Code: "abc"}, "name: must match ^[a-z]+$; code: length must be exactly 4; accepted: must be true"},
+		{&CreateItemRequest{}, "code: is required; accepted: must be true"},
+	} {
+		got := ""
+		if err := test.req.Validate(); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("Validate(%v) = %q, want %q", test.req, got, test.want)
+		}
+	}
+}
+`})
+}
+
+func TestGeneratedPathParams(t *testing.T) {
+	testScratch(t, `
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+}
+
+// @parser:"fiber"
+message GetItemRequest {
+  // In: path
+  string id = 1;
+  // In: path
+  int32 count = 2;
+  // In: path
+  sint64 offset = 3;
+  // In: path
+  uint32 page = 4;
+  // In: path
+  fixed64 size = 5;
+  // In: path
+  bool active = 6;
+  // In: path
+  float ratio = 7;
+  // In: path
+  double score = 8;
+  // In: path
+  Color color = 9;
+  // In: path
+  optional int32 level = 10;
+}
+`, scratchSettings(), map[string]string{"api/path_test.go": `package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBindPath(t *testing.T) {
+	var got *GetItemRequest
+	app := fiber.New()
+	app.Get("/:id/:count/:offset/:page/:size/:active/:ratio/:score/:color/:level", func(ctx *fiber.Ctx) error {
+		got = new(GetItemRequest)
+		return got.BindFromFiber(ctx)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/a1/-2/-3/4/5/true/0.5/1.25/COLOR_RED/0", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	want := &GetItemRequest{
+		Id:     "a1",
+		Count:  -2,
+		Offset: -3,
+		Page:   4,
+		Size:   5,
+		Active: true,
+		Ratio:  0.5,
+		Score:  1.25,
+		Color:  Color_COLOR_RED,
+		Level:  proto.Int32(0),
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("BindFromFiber() = %v, want %v", got, want)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/a1/-2/-3/4/5/true/0.5/1.25/1/0", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || got.Color != Color_COLOR_RED {
+		t.Errorf("color by number: status %d, color %v", resp.StatusCode, got.Color)
+	}
+
+	for path, param := range map[string]string{
+		"/a1/two/-3/4/5/true/0.5/1.25/1/0":   "count",
+		"/a1/-2/-3/-4/5/true/0.5/1.25/1/0":   "page",
+		"/a1/-2/-3/4/5/yes/0.5/1.25/1/0":     "active",
+		"/a1/-2/-3/4/5/true/0.5/1.25/BLUE/0": "color",
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if want := "invalid path parameter " + param + ": "; resp.StatusCode != 400 || !strings.HasPrefix(string(body), want) {
+			t.Errorf("GET %s = %d %q, want 400 %q...", path, resp.StatusCode, body, want)
+		}
+	}
+}
+`})
+}
+
+func TestGeneratedHeaderCookieParams(t *testing.T) {
+	testScratch(t, `
+// @parser:"fiber"
+message GetItemRequest {
+  // In: header
+  string request_id = 1;
+  // In: header:Accept-Language
+  string locale = 2;
+  // In: header
+  optional int64 version = 3;
+  // In: cookie
+  string session = 4;
+  // In: cookie:remember
+  bool remember_me = 5;
+}
+`, scratchSettings(), map[string]string{"api/header_test.go": `package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBindHeaderCookie(t *testing.T) {
+	var got *GetItemRequest
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		got = new(GetItemRequest)
+		return got.BindFromFiber(ctx)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Request-Id", "r1")
+	req.Header.Set("Accept-Language", "en")
+	req.Header.Set("Version", "3")
+	req.Header.Set("Cookie", "session=s1; remember=true")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	want := &GetItemRequest{RequestId: "r1", Locale: "en", Version: proto.Int64(3), Session: "s1", RememberMe: true}
+	if !proto.Equal(got, want) {
+		t.Errorf("BindFromFiber() = %v, want %v", got, want)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || !proto.Equal(got, &GetItemRequest{}) {
+		t.Errorf("BindFromFiber() without headers = %d %v", resp.StatusCode, got)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Version", "v3")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if want := "invalid header parameter Version: "; resp.StatusCode != 400 || !strings.HasPrefix(string(body), want) {
+		t.Errorf("invalid Version header = %d %q, want 400 %q...", resp.StatusCode, body, want)
+	}
+}
+`})
+}
+
+func TestGeneratedContextLocals(t *testing.T) {
+	testScratch(t, `
+enum Role {
+  ROLE_UNSPECIFIED = 0;
+  ROLE_ADMIN = 1;
+}
+
+message User {
+  string id = 1;
+}
+
+// @parser:"fiber"
+message GetItemRequest {
+  // In: context
+  string user_id = 1;
+  // In: context
+  User user = 2;
+  // In: context
+  Role role = 3;
+  // In: context
+  repeated string scopes = 4;
+  // In: context
+  map<string, string> claims = 5;
+  // In: context
+  optional int64 tenant = 6;
+}
+`, scratchSettings(), map[string]string{"api/context_test.go": `package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBindContext(t *testing.T) {
+	var got *GetItemRequest
+	var bindErr error
+	locals := map[string]interface{}{}
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		for name, value := range locals {
+			ctx.Locals(name, value)
+		}
+		got = new(GetItemRequest)
+		bindErr = got.BindFromFiber(ctx)
+		return nil
+	})
+	bind := func() {
+		t.Helper()
+		if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bind()
+	if bindErr != nil || !proto.Equal(got, &GetItemRequest{}) {
+		t.Errorf("BindFromFiber() without locals = %v, %v", got, bindErr)
+	}
+
+	locals = map[string]interface{}{
+		"user_id": "u1",
+		"user":    &User{Id: "u1"},
+		"role":    Role_ROLE_ADMIN,
+		"scopes":  []string{"read"},
+		"claims":  map[string]string{"sub": "u1"},
+		"tenant":  int64(7),
+	}
+	bind()
+	want := &GetItemRequest{
+		UserId: "u1",
+		User:   &User{Id: "u1"},
+		Role:   Role_ROLE_ADMIN,
+		Scopes: []string{"read"},
+		Claims: map[string]string{"sub": "u1"},
+		Tenant: proto.Int64(7),
+	}
+	if bindErr != nil || !proto.Equal(got, want) {
+		t.Errorf("BindFromFiber() = %v, %v, want %v", got, bindErr, want)
+	}
+
+	locals = map[string]interface{}{"role": int32(1)}
+	bind()
+	if want := "context value role is int32, want Role"; bindErr == nil || bindErr.Error() != want {
+		t.Errorf("BindFromFiber() error = %v, want %s", bindErr, want)
+	}
+}
+`})
+}
+
+func TestGeneratedParserErrors(t *testing.T) {
+	testScratch(t, `
+// @parser:"fiber"
+message ListItemsRequest {
+  int32 limit = 1;
+  repeated int32 ids = 2;
+}
+
+// @parser:"fiber"
+message CreateItemRequest {
+  // In: body
+  int32 count = 1;
+}
+`, scratchSettings(), map[string]string{"api/parser_test.go": `package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParserErrors(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return new(ListItemsRequest).BindFromFiber(ctx)
+	})
+	app.Post("/", func(ctx *fiber.Ctx) error {
+		return new(CreateItemRequest).BindFromFiber(ctx)
+	})
+
+	for _, test := range []struct {
+		method, target, contentType, body string
+		status                            int
+		message                           string
+	}{
+		{"GET", "/?limit=10&ids=1&ids=2", "", "", 200, ""},
+		{"GET", "/?ids=one", "", "", 400, "invalid query: "},
+		{"POST", "/", "application/json", "{\"count\": 2}", 200, ""},
+		{"POST", "/", "application/json", "{\"count\": \"two\"}", 400, "invalid body: "},
+		{"POST", "/", "text/csv", "count\n2", 422, "Unprocessable Entity"},
+	} {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != test.status || !strings.HasPrefix(string(body), test.message) {
+			t.Errorf("%s %s %q = %d %q, want %d %q...", test.method, test.target, test.body, resp.StatusCode, body, test.status, test.message)
+		}
+	}
+}
+`})
+}
+
+// scratchServer declares the ItemsServer which protoc-gen-go-grpc generates
+// for the Items service of the route tests.
+const scratchServer = `package api
+
+import "context"
+
+type ItemsServer interface {
+	GetItem(context.Context, *GetItemRequest) (*Item, error)
+}
+`
+
+func TestGeneratedRoutes(t *testing.T) {
+	testScratch(t, `
+// @parser:"fiber"
+message GetItemRequest {
+  // In: path
+  string id = 1;
+}
+
+message Item {
+  string id = 1;
+  string name = 2;
+}
+
+service Items {
+  // @route:"GET /items/:id"
+  rpc GetItem(GetItemRequest) returns (Item);
+}
+`, scratchSettings(), map[string]string{"api/server.go": scratchServer, "api/routes_test.go": `package api
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type items struct{}
+
+func (items) GetItem(_ context.Context, req *GetItemRequest) (*Item, error) {
+	if req.Id != "a1" {
+		return nil, status.Error(codes.NotFound, "no item "+req.Id)
+	}
+	return &Item{Id: req.Id, Name: "first"}, nil
+}
+
+func TestRoutes(t *testing.T) {
+	app := fiber.New()
+	RegisterItemsFiberRoutes(app, items{})
+
+	for _, test := range []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/items/a1", 200, ` + "`" + `{"id":"a1","name":"first"}` + "`" + `},
+		{"/items/b2", 404, "no item b2"},
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", test.target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != test.status || string(body) != test.body {
+			t.Errorf("GET %s = %d %q, want %d %q", test.target, resp.StatusCode, body, test.status, test.body)
+		}
+	}
+}
+`})
+}
+
+func TestGeneratedHTTPRules(t *testing.T) {
+	generated, err := generateScratch(t, map[string]string{
+		"api.proto": scratchHeader + `
+// @parser:"fiber"
+message GetItemRequest {
+  string shelf = 1;
+  string id = 2;
+  string view = 3;
+}
+
+// @parser:"fiber"
+message CreateItemRequest {
+  string shelf = 1;
+  Item item = 2;
+  string request_id = 3;
+}
+
+// @parser:"fiber"
+message UpdateItemRequest {
+  string id = 1;
+  string name = 2;
+  int32 count = 3;
+}
+
+message Item {
+  string id = 1;
+  string name = 2;
+  int32 count = 3;
+}
+`,
+		// The service is declared in a file of its own, apart from its
+		// requests.
+		"service.proto": `syntax = "proto3";
+
+package scratch;
+
+import "api.proto";
+import "google/api/annotations.proto";
+
+option go_package = "example.com/scratch/api";
+
+service Items {
+  rpc GetItem(GetItemRequest) returns (Item) {
+    option (google.api.http) = {
+      get: "/v1/items/{id}"
+      additional_bindings { get: "/v1/shelves/{shelf}/items/{id}" }
+    };
+  }
+  rpc CreateItem(CreateItemRequest) returns (Item) {
+    option (google.api.http) = {
+      post: "/v1/shelves/{shelf}/items"
+      body: "item"
+    };
+  }
+  rpc UpdateItem(UpdateItemRequest) returns (Item) {
+    option (google.api.http) = {
+      patch: "/v1/items/{id}"
+      body: "*"
+    };
+  }
+}
+`,
+	}, scratchSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated["api/server.go"] = `package api
+
+import "context"
+
+type ItemsServer interface {
+	GetItem(context.Context, *GetItemRequest) (*Item, error)
+	CreateItem(context.Context, *CreateItemRequest) (*Item, error)
+	UpdateItem(context.Context, *UpdateItemRequest) (*Item, error)
+}
+`
+	generated["api/rules_test.go"] = `package api
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type items struct{}
+
+func (items) GetItem(_ context.Context, req *GetItemRequest) (*Item, error) {
+	return &Item{Id: req.Id, Name: req.Shelf + "/" + req.View}, nil
+}
+
+func (items) CreateItem(_ context.Context, req *CreateItemRequest) (*Item, error) {
+	return &Item{Id: req.RequestId, Name: req.Shelf + "/" + req.GetItem().GetName(), Count: req.GetItem().GetCount()}, nil
+}
+
+func (items) UpdateItem(_ context.Context, req *UpdateItemRequest) (*Item, error) {
+	return &Item{Id: req.Id, Name: req.Name, Count: req.Count}, nil
+}
+
+func TestRules(t *testing.T) {
+	app := fiber.New()
+	RegisterItemsFiberRoutes(app, items{})
+
+	for _, test := range []struct {
+		method, target, body string
+		want                 string
+	}{
+		{"GET", "/v1/items/a1?view=full", "", ` + "`" + `{"id":"a1","name":"/full"}` + "`" + `},
+		{"GET", "/v1/shelves/s1/items/a1?view=full", "", ` + "`" + `{"id":"a1","name":"s1/full"}` + "`" + `},
+		{"POST", "/v1/shelves/s1/items?request_id=r1", ` + "`" + `{"name":"first","count":2}` + "`" + `, ` + "`" + `{"id":"r1","name":"s1/first","count":2}` + "`" + `},
+		{"PATCH", "/v1/items/a1", ` + "`" + `{"name":"second","count":3}` + "`" + `, ` + "`" + `{"id":"a1","name":"second","count":3}` + "`" + `},
+	} {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 || string(body) != test.want {
+			t.Errorf("%s %s %s = %d %s, want 200 %s", test.method, test.target, test.body, resp.StatusCode, body, test.want)
+		}
+	}
+}
+`
+	buildScratch(t, generated)
+}
+
+func TestGeneratedHTTPUpload(t *testing.T) {
+	opts := scratchSettings()
+	opts.httpBinder = true
+	testScratch(t, `
+// @parser:"fiber"
+message UploadRequest {
+  bytes avatar = 1 [(field_option) = {source: "formData"}];
+  bytes document = 2 [(field_option) = {source: "formData", max_size: 4, filename_field: "document_name"}];
+  string document_name = 3;
+}
+`, opts, map[string]string{"api/upload_test.go": `package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func upload(t *testing.T, document string) (*UploadRequest, error) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, content := range map[string]string{"avatar": "abc", "document": document} {
+		part, err := form.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+	form.Close()
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	x := new(UploadRequest)
+	return x, x.BindFromHTTP(req, nil)
+}
+
+func TestBindUpload(t *testing.T) {
+	want := &UploadRequest{Avatar: []byte("abc"), Document: []byte("xy"), DocumentName: "document.txt"}
+	if got, err := upload(t, "xy"); err != nil || !proto.Equal(got, want) {
+		t.Errorf("BindFromHTTP() = %v, %v, want %v", got, err, want)
+	}
+	if _, err := upload(t, "large"); err == nil || err.Error() != "document: file document exceeds 4 bytes" {
+		t.Errorf("BindFromHTTP() of a large document = %v", err)
+	}
+}
+`})
+}
+
+func TestGeneratedHTTPContext(t *testing.T) {
+	opts := scratchSettings()
+	opts.httpBinder = true
+	testScratch(t, `
+// @parser:"fiber"
+message GetItemRequest {
+  // In: path
+  string id = 1;
+  // In: context
+  string user_id = 2;
+  // In: context
+  optional int64 tenant = 3;
+}
+`, opts, map[string]string{"api/context_test.go": `package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/validation"
+)
+
+type stringKey string
+
+func TestBindContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "/items/i1", nil)
+	path := func(name string) string {
+		return map[string]string{"id": "i1"}[name]
+	}
+
+	// Values stored under keys of other types are not read.
+	ctx := context.WithValue(req.Context(), stringKey("user_id"), "u0")
+	ctx = context.WithValue(ctx, "user_id", "u0")
+	got := new(GetItemRequest)
+	if err := got.BindFromHTTP(req.WithContext(ctx), path); err != nil || !proto.Equal(got, &GetItemRequest{Id: "i1"}) {
+		t.Errorf("BindFromHTTP() without context values = %v, %v", got, err)
+	}
+
+	ctx = context.WithValue(ctx, validation.ContextKey("user_id"), "u1")
+	got = new(GetItemRequest)
+	err := got.BindFromHTTP(req.WithContext(context.WithValue(ctx, validation.ContextKey("tenant"), int64(7))), path)
+	if want := (&GetItemRequest{Id: "i1", UserId: "u1", Tenant: proto.Int64(7)}); err != nil || !proto.Equal(got, want) {
+		t.Errorf("BindFromHTTP() = %v, %v, want %v", got, err, want)
+	}
+
+	err = new(GetItemRequest).BindFromHTTP(req.WithContext(context.WithValue(ctx, validation.ContextKey("tenant"), 7)), nil)
+	if err == nil || err.Error() != "context value tenant is int, want int64" {
+		t.Errorf("BindFromHTTP() error = %v", err)
+	}
+}
+`})
+}
+
+func TestGenerateCommonProto(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("common", "common.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generateScratch(t, map[string]string{"common.proto": string(content)}, scratchSettings()); err != nil {
+		t.Errorf("generate common.proto: %v", err)
+	}
+}
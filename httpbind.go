@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const (
+	goJSONPackage = protogen.GoImportPath("github.com/goccy/go-json")
+	httpPackage   = protogen.GoImportPath("net/http")
+)
+
+// httpReaders maps the sources of string parameters to the Go expressions
+// reading them in BindFromHTTP, applied to the quoted parameter name.
+var httpReaders = map[string]string{
+	sourcePath:     "pathParam",
+	sourceHeader:   "r.Header.Get",
+	sourceQuery:    "query.Get",
+	sourceFormData: "r.FormValue",
+}
+
+// httpSource returns the source of field in BindFromHTTP, where the fields
+// without a source are read from the query as QueryParser does for Fiber.
+func httpSource(field *protogen.Field) (source, name string) {
+	source, name = fieldBinding(field)
+	if source == "" {
+		source = sourceQuery
+	}
+	return source, name
+}
+
+// generateHTTPParam emits the binding of field from the parameter param of the
+// request r. Conversion errors are returned as validation errors of the field.
+func generateHTTPParam(g *protogen.GeneratedFile, field *protogen.Field, source, param string, validation protogen.GoImportPath) error {
+	failure := func() {
+		g.P("return ", validation.Ident("NewError"), "(", strconv.Quote(string(field.Desc.Name())), ", \"invalid ", source, " parameter ", param, ": \"+err.Error())")
+	}
+	var err error
+	switch {
+	case source == sourceQuery && field.Desc.IsList():
+		g.P("for _, value := range query[", strconv.Quote(param), "] {")
+		err = generateParseList(g, field, "value", failure)
+	case source == sourceCookie:
+		g.P("if cookie, err := r.Cookie(", strconv.Quote(param), "); err == nil && cookie.Value != \"\" {")
+		g.P("value := cookie.Value")
+		err = generateParse(g, field, "value", failure)
+	default:
+		g.P("if value := ", httpReaders[source], "(", strconv.Quote(param), "); value != \"\" {")
+		err = generateParse(g, field, "value", failure)
+	}
+	g.P("}")
+	return err
+}
+
+// generateHTTPFile emits the binding of the bytes field from the file uploaded
+// in the multipart form field named param.
+func generateHTTPFile(g *protogen.GeneratedFile, field *protogen.Field, param string, validation protogen.GoImportPath) error {
+	header := "_"
+	if readsUploadHeader(field) {
+		header = "header"
+	}
+	g.P("if file, ", header, ", err := r.FormFile(", strconv.Quote(param), "); err == nil {")
+	g.P("defer file.Close()")
+	err := generateUpload(g, field, func(limit int64) {
+		g.P("return ", validation.Ident("NewError"), "(", strconv.Quote(string(field.Desc.Name())), ", \"file ", param, " exceeds ", limit, " bytes\")")
+	})
+	g.P("}")
+	return err
+}
+
+// generateHTTPBody emits the decoding of the JSON body of r into target. An
+// empty body is not an error.
+func generateHTTPBody(g *protogen.GeneratedFile, target string, validation protogen.GoImportPath) {
+	g.P("if err := ", goJSONPackage.Ident("NewDecoder"), "(r.Body).Decode(", target, "); err != nil && !", errorsPackage.Ident("Is"), "(err, ", ioPackage.Ident("EOF"), ") {")
+	g.P("return ", validation.Ident("NewError"), "(\"\", \"invalid body: \"+err.Error())")
+	g.P("}")
+}
+
+// generateHTTPBinder emits the BindFromHTTP method of msg binding a net/http
+// request from the same sources as BindFromFiber. The path parameters are
+// looked up with a function, so that any router can be used, and the context
+// values under the typed ContextKey of the validation package, so that they do
+// not collide with the string keys of other packages.
+func generateHTTPBinder(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message, validation protogen.GoImportPath) {
+	var hasPath, hasQuery bool
+	for _, field := range msg.Fields {
+		switch source, _ := httpSource(field); source {
+		case sourcePath:
+			hasPath = true
+		case sourceQuery:
+			hasQuery = hasQuery || field.Message == nil && !field.Desc.IsMap()
+		}
+	}
+
+	g.P()
+	g.P("// BindFromHTTP binds the request r to x. pathParam returns the path parameter")
+	g.P("// of the given name, e.g. chi.URLParam of r or r.PathValue, and may be nil.")
+	g.P("// Context values are read under the ContextKey of their name of the")
+	g.P("// validation package.")
+	g.P("func (x *", msg.GoIdent, ") BindFromHTTP(r *", httpPackage.Ident("Request"), ", pathParam func(string) string) error {")
+	if hasPath {
+		g.P("if pathParam == nil {")
+		g.P("pathParam = func(string) string { return \"\" }")
+		g.P("}")
+	}
+	if hasQuery {
+		g.P("query := r.URL.Query()")
+	}
+	if _, err := messageHTTPBinding(msg); err != nil {
+		gen.Error(err)
+	}
+	// The query and then the body are bound first, as QueryParser and
+	// BodyParser are by BindFromFiber, so that the other sources take
+	// precedence.
+	for _, field := range msg.Fields {
+		if source, name := httpSource(field); source == sourceQuery && field.Message == nil && !field.Desc.IsMap() {
+			if err := generateHTTPParam(g, field, source, name, validation); err != nil {
+				gen.Error(err)
+			}
+		}
+	}
+	if hasBodyParams(msg.Fields) {
+		generateHTTPBody(g, "x", validation)
+	}
+	for _, field := range msg.Fields {
+		if isHTTPBody(field) {
+			if field.Message != nil && !field.Desc.IsList() && !field.Desc.IsMap() {
+				g.P("x.", field.GoName, " = new(", field.Message.GoIdent, ")")
+				generateHTTPBody(g, "x."+field.GoName, validation)
+			} else {
+				generateHTTPBody(g, "&x."+field.GoName, validation)
+			}
+			continue
+		}
+		source, name := httpSource(field)
+		switch {
+		case source == sourceContext:
+			generateLocal(g, field, name, "r.Context().Value("+g.QualifiedGoIdent(validation.Ident("ContextKey"))+"("+strconv.Quote(name)+"))")
+			continue
+		case source == sourceQuery:
+			continue
+		case isUpload(field):
+			if err := generateHTTPFile(g, field, name, validation); err != nil {
+				gen.Error(err)
+			}
+			continue
+		}
+		if _, ok := httpReaders[source]; !ok && source != sourceCookie {
+			continue
+		}
+		if err := generateHTTPParam(g, field, source, name, validation); err != nil {
+			gen.Error(err)
+		}
+	}
+	g.P("return nil")
+	g.P("}")
+}
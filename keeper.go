@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// encryptedField is a field encrypted by EncryptFields with a transit key.
+type encryptedField struct {
+	field *protogen.Field
+	key   string
+}
+
+// transitKey returns the key of the @feature:"keeper=..." directive of msg.
+func transitKey(msg *protogen.Message) (string, bool) {
+	for _, feature := range commentDirectives(msg.Comments).values("feature") {
+		if key := strings.TrimPrefix(feature, "keeper="); key != feature {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// encryptedFields returns the fields of msg marked encrypted by their field
+// option or an @encrypted:"<transit key>" directive. A field without a key of
+// its own is encrypted with the key of its message.
+func encryptedFields(msg *protogen.Message) ([]encryptedField, error) {
+	var fields []encryptedField
+	for _, field := range msg.Fields {
+		option := fieldOption(field)
+		key, marked := commentDirectives(field.Comments).value("encrypted")
+		if option.GetEncrypted() {
+			marked = true
+			if option.TransitKey != nil {
+				key = option.GetTransitKey()
+			}
+		}
+		if !marked {
+			continue
+		}
+		kind := field.Desc.Kind()
+		if field.Desc.IsList() || field.Desc.IsMap() || kind != protoreflect.StringKind && kind != protoreflect.BytesKind {
+			return nil, fieldErrorf(field, "%s field cannot be encrypted, only string and bytes fields can", fieldKind(field))
+		}
+		if key == "" {
+			if key, _ = transitKey(msg); key == "" {
+				return nil, fieldErrorf(field, "encrypted field has no transit key, set its transit_key or @feature:\"keeper=<transit key>\" on its message")
+			}
+		}
+		fields = append(fields, encryptedField{field: field, key: key})
+	}
+	return fields, nil
+}
+
+// generateFieldEncryption emits the EncryptFields and DecryptFields methods of
+// msg encrypting its encrypted fields one by one with TransitEncryptValue and
+// TransitDecryptValue of the keeper, which the keeper package is expected to
+// declare as
+//
+//	TransitEncryptValue(ctx context.Context, plaintext []byte, key string) (string, error)
+//	TransitDecryptValue(ctx context.Context, ciphertext string, key string) ([]byte, error)
+//
+// The ciphertext of a bytes field is stored as its bytes.
+func generateFieldEncryption(g *protogen.GeneratedFile, msg *protogen.Message, fields []encryptedField, keeper protogen.GoImportPath) {
+	params := "(ctx " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ", keepr " + g.QualifiedGoIdent(keeper.Ident("Keeper")) + ") error"
+	failure := func(verb string, field *protogen.Field) {
+		g.P("if err != nil {")
+		g.P("return ", fmtPackage.Ident("Errorf"), "(\"", verb, " ", field.Desc.Name(), ": %w\", err)")
+		g.P("}")
+	}
+
+	g.P("// EncryptFields encrypts the encrypted fields of x with keepr.")
+	g.P("func (x *", msg.GoIdent, ") EncryptFields", params, " {")
+	for _, f := range fields {
+		value, bytes := "x."+f.field.GoName, f.field.Desc.Kind() == protoreflect.BytesKind
+		g.P("if ", nonZeroCheck(f.field, "x"), " {")
+		plaintext := value
+		switch {
+		case f.field.Desc.HasOptionalKeyword() && !bytes:
+			plaintext = "[]byte(*" + value + ")"
+		case !bytes:
+			plaintext = "[]byte(" + value + ")"
+		}
+		g.P("ciphertext, err := keepr.TransitEncryptValue(ctx, ", plaintext, ", ", strconv.Quote(f.key), ")")
+		failure("encrypt", f.field)
+		switch {
+		case bytes:
+			g.P(value, " = []byte(ciphertext)")
+		case f.field.Desc.HasOptionalKeyword():
+			g.P(value, " = &ciphertext")
+		default:
+			g.P(value, " = ciphertext")
+		}
+		g.P("}")
+	}
+	g.P("return nil")
+	g.P("}")
+	g.P()
+
+	g.P("// DecryptFields decrypts the encrypted fields of x with keepr.")
+	g.P("func (x *", msg.GoIdent, ") DecryptFields", params, " {")
+	for _, f := range fields {
+		value, bytes := "x."+f.field.GoName, f.field.Desc.Kind() == protoreflect.BytesKind
+		g.P("if ", nonZeroCheck(f.field, "x"), " {")
+		ciphertext := value
+		switch {
+		case bytes:
+			ciphertext = "string(" + value + ")"
+		case f.field.Desc.HasOptionalKeyword():
+			ciphertext = "*" + value
+		}
+		g.P("plaintext, err := keepr.TransitDecryptValue(ctx, ", ciphertext, ", ", strconv.Quote(f.key), ")")
+		failure("decrypt", f.field)
+		switch {
+		case bytes:
+			g.P(value, " = plaintext")
+		case f.field.Desc.HasOptionalKeyword():
+			g.P("decrypted := string(plaintext)")
+			g.P(value, " = &decrypted")
+		default:
+			g.P(value, " = string(plaintext)")
+		}
+		g.P("}")
+	}
+	g.P("return nil")
+	g.P("}")
+}
+
+// generateKeeper emits the EncryptFields and DecryptFields methods of msg. The
+// messages with encrypted fields encrypt them one by one, while a message
+// with only a @feature:"keeper=..." directive is encrypted as a whole by
+// TransitEncrypt and TransitDecrypt of the keeper, declared as
+//
+//	TransitEncrypt(ctx context.Context, v interface{}, key string) error
+//	TransitDecrypt(ctx context.Context, v interface{}, key string) error
+//
+// unless opts.legacyKeeper keeps the methods without an error result, for
+// keepers whose methods return none.
+func generateKeeper(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message, opts settings) {
+	fields, err := encryptedFields(msg)
+	if err != nil {
+		gen.Error(err)
+		return
+	}
+	key, ok := transitKey(msg)
+	if len(fields) == 0 && !ok {
+		return
+	}
+	keeper, err := opts.pkgs.keeper()
+	if err != nil {
+		gen.Error(messageErrorf(msg, "%v", err))
+		return
+	}
+	if len(fields) > 0 {
+		generateFieldEncryption(g, msg, fields, keeper)
+		return
+	}
+	params := "(ctx " + g.QualifiedGoIdent(contextPackage.Ident("Context")) + ", keepr " + g.QualifiedGoIdent(keeper.Ident("Keeper")) + ")"
+	if opts.legacyKeeper {
+		g.P("func (x *", msg.GoIdent, ") EncryptFields", params, " {")
+		g.P("keepr.TransitEncrypt(ctx, x, ", strconv.Quote(key), ")")
+		g.P("}")
+
+		g.P("func (x *", msg.GoIdent, ") DecryptFields", params, " {")
+		g.P("keepr.TransitDecrypt(ctx, x, ", strconv.Quote(key), ")")
+		g.P("}")
+		return
+	}
+	g.P("// EncryptFields encrypts x with keepr.")
+	g.P("func (x *", msg.GoIdent, ") EncryptFields", params, " error {")
+	g.P("return keepr.TransitEncrypt(ctx, x, ", strconv.Quote(key), ")")
+	g.P("}")
+	g.P()
+	g.P("// DecryptFields decrypts x with keepr.")
+	g.P("func (x *", msg.GoIdent, ") DecryptFields", params, " error {")
+	g.P("return keepr.TransitDecrypt(ctx, x, ", strconv.Quote(key), ")")
+	g.P("}")
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
@@ -20,23 +22,169 @@ import (
 const (
 	contextPackage = protogen.GoImportPath("context")
 	fmtPackage     = protogen.GoImportPath("fmt")
+	errorsPackage  = protogen.GoImportPath("errors")
+	reflectPackage = protogen.GoImportPath("reflect")
+	bsonPackage    = protogen.GoImportPath("go.mongodb.org/mongo-driver/bson")
 )
 
 func main() {
 	var flags flag.FlagSet
+	modulePath := flags.String("module_path", "", "Go module the default package paths are derived from; defaults to the module parameter, then to the go.mod above the working directory")
+	keeperPackage := flags.String("keeper_package", "", "import path of the keeper package; defaults to <module>/internal/keeper")
+	commonPackage := flags.String("common_package", "", "import path of the common package; defaults to <module>/pkg/common")
+	validationPackage := flags.String("validation_package", "", "import path of a copy of the validation package; defaults to the package of the plugin")
+	fiberBinder := flags.Bool("fiber_binder", true, "generate BindFromFiber for messages with the fiber parser")
+	httpBinder := flags.Bool("http_binder", false, "generate BindFromHTTP for messages with the fiber parser")
+	writeManifest := flags.Bool("manifest", false, "write a JSON manifest of the generated helpers per proto file")
+	legacyKeeper := flags.Bool("keeper_legacy", false, "generate EncryptFields and DecryptFields without an error result, for keepers returning none")
+	writeOpenAPI := flags.Bool("openapi", false, "write an OpenAPI 3 document per proto package")
 	protogen.Options{
 		ParamFunc: flags.Set,
 	}.Run(func(gen *protogen.Plugin) error {
+		pkgs := newPackages(pluginModule(gen, *modulePath), *keeperPackage, *commonPackage, *validationPackage)
+		opts := settings{pkgs: pkgs, fiberBinder: *fiberBinder, httpBinder: *httpBinder, legacyKeeper: *legacyKeeper}
 		for _, f := range gen.Files {
 			if !f.Generate {
 				continue
 			}
-			generateHelpers(gen, f)
+			g := generateHelpers(gen, f, opts)
+			if *writeManifest {
+				generateManifest(gen, f, g)
+			}
+		}
+		if *writeOpenAPI {
+			generateOpenAPI(gen, opts)
 		}
 		return nil
 	})
 }
 
+// pluginParameter returns the value of the named plugin parameter.
+func pluginParameter(gen *protogen.Plugin, name string) string {
+	for _, param := range strings.Split(gen.Request.GetParameter(), ",") {
+		if key, value, _ := strings.Cut(param, "="); key == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// pluginModule returns the module_path parameter modulePath, or else the module
+// parameter. The module parameter is consumed by protogen and never reaches
+// the flags. As protogen also strips the module from the output paths, which
+// paths=source_relative does not allow, module_path takes precedence.
+func pluginModule(gen *protogen.Plugin, modulePath string) string {
+	if modulePath != "" {
+		return modulePath
+	}
+	return pluginParameter(gen, "module")
+}
+
+// packages resolves the import paths of the project packages referenced by the
+// generated code. Paths which are not given explicitly are derived from the
+// module when first needed, so that runs generating no reference to the
+// packages do not depend on a module.
+type packages struct {
+	module            string
+	keeperPackage     string
+	commonPackage     string
+	validationPackage string
+	moduleErr         error
+	resolved          bool
+}
+
+func newPackages(module, keeperPackage, commonPackage, validationPackage string) *packages {
+	return &packages{module: module, keeperPackage: keeperPackage, commonPackage: commonPackage, validationPackage: validationPackage}
+}
+
+// settings holds the plugin parameters shaping the generated code.
+type settings struct {
+	pkgs *packages
+	// fiberBinder and httpBinder select the binders generated for messages
+	// with the fiber parser.
+	fiberBinder bool
+	httpBinder  bool
+	// legacyKeeper keeps the EncryptFields and DecryptFields of messages
+	// encrypted as a whole without an error result.
+	legacyKeeper bool
+}
+
+// modulePath returns the module the package paths are derived from, which is
+// the module_path or module parameter or else the module of the nearest go.mod
+// above the working directory.
+func (p *packages) modulePath() (string, error) {
+	if p.module != "" || p.resolved {
+		return p.module, p.moduleErr
+	}
+	p.resolved = true
+	dir, err := os.Getwd()
+	if err == nil {
+		p.module, err = findModulePath(dir)
+	}
+	if err != nil {
+		p.moduleErr = fmt.Errorf("%v: set the module_path, keeper_package and common_package parameters", err)
+	}
+	return p.module, p.moduleErr
+}
+
+// resolve returns path, or the path derived by appending suffix to the module
+// when path is empty.
+func (p *packages) resolve(path, suffix string) (protogen.GoImportPath, error) {
+	if path != "" {
+		return protogen.GoImportPath(path), nil
+	}
+	module, err := p.modulePath()
+	if err != nil {
+		return "", err
+	}
+	return protogen.GoImportPath(module + suffix), nil
+}
+
+// keeper returns the import path of the keeper package, <module>/internal/keeper
+// by default.
+func (p *packages) keeper() (protogen.GoImportPath, error) {
+	return p.resolve(p.keeperPackage, "/internal/keeper")
+}
+
+// common returns the import path of the common package, <module>/pkg/common by
+// default.
+func (p *packages) common() (protogen.GoImportPath, error) {
+	return p.resolve(p.commonPackage, "/pkg/common")
+}
+
+// validation returns the import path of the validation package. A copy of the
+// package of the plugin may be named to drop the dependency of the generated
+// code on the plugin module.
+func (p *packages) validation() protogen.GoImportPath {
+	if p == nil || p.validationPackage == "" {
+		return defaultValidationPackage
+	}
+	return protogen.GoImportPath(p.validationPackage)
+}
+
+// findModulePath returns the module path of the first go.mod found in dir or
+// any of its parents.
+func findModulePath(dir string) (string, error) {
+	start := dir
+	for {
+		mod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			if path := ModulePath(mod); path != "" {
+				return path, nil
+			}
+			return "", fmt.Errorf("no module path in %s", filepath.Join(dir, "go.mod"))
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no go.mod found in %s or any parent directory", start)
+		}
+		dir = parent
+	}
+}
+
 func getFieldsFromMessage(messages []*protogen.Message, messageName string) []*protogen.Field {
 	for _, message := range messages {
 		if string(message.Desc.FullName().Name()) == messageName {
@@ -59,9 +207,204 @@ func getFieldFromMessage(messages []*protogen.Message, entityName string, fieldN
 	return nil
 }
 
+// parserOption returns the (parser) message option of msg. Flags that are not
+// set by the option fall back to the legacy comment directives.
+func parserOption(msg *protogen.Message) *common.ParserOption {
+	parser := new(common.ParserOption)
+	if options, ok := msg.Desc.Options().(*descriptorpb.MessageOptions); ok && options != nil {
+		if ext, ok := proto.GetExtension(options, common.E_Parser).(*common.ParserOption); ok && ext != nil {
+			parser = proto.Clone(ext).(*common.ParserOption)
+		}
+	}
+
+	directives := commentDirectives(msg.Comments)
+	parser.Fiber = parser.Fiber || directives.has("parser", "fiber")
+	parser.Swag = parser.Swag || directives.has("parser", "swag")
+	parser.SwagResponse = parser.SwagResponse || directives.has("parser", "swag-response")
+	parser.List = parser.List || directives.has("parser", "list")
+	parser.Paging = parser.Paging || directives.has("paging", "true")
+	parser.Cursor = parser.Cursor || directives.has("cursor", "true")
+	if sort, ok := directives.value("sort"); ok && parser.Sort == "" {
+		parser.Sort = sort
+	}
+	if sortable, ok := directives.value("sortable"); ok && len(parser.Sortable) == 0 {
+		parser.Sortable = strings.Split(sortable, ",")
+	}
+	if projection, ok := directives.value("projection"); ok && parser.Projection == "" {
+		parser.Projection = projection
+	}
+	if limits, ok := directives.value("limit"); ok {
+		// A malformed @limit is reported by checkDirectives, and then ignored.
+		if defaultLimit, maxLimit, err := parseLimit(limits); err == nil {
+			if parser.DefaultLimit == 0 {
+				parser.DefaultLimit = defaultLimit
+			}
+			if parser.MaxLimit == 0 {
+				parser.MaxLimit = maxLimit
+			}
+		}
+	}
+	return parser
+}
+
+const (
+	sourceBody     = "body"
+	sourcePath     = "path"
+	sourceContext  = "context"
+	sourceHeader   = "header"
+	sourceCookie   = "cookie"
+	sourceFormData = "formData"
+	sourceQuery    = "query"
+)
+
+var sourceRegexp = regexp.MustCompile(`In: (\w+(?::[\w.-]+)?)`)
+
+// fieldOption returns the (field_option) option of field, or an empty option
+// when it is not set.
+func fieldOption(field *protogen.Field) *common.ModelFieldOption {
+	if options, ok := field.Desc.Options().(*descriptorpb.FieldOptions); ok && options != nil {
+		if ext, ok := proto.GetExtension(options, common.E_FieldOption).(*common.ModelFieldOption); ok && ext != nil {
+			return ext
+		}
+	}
+	return new(common.ModelFieldOption)
+}
+
+// fieldSource returns where the value of field is bound from. The source of
+// the field option takes precedence over an "In: ..." leading comment.
+func fieldSource(field *protogen.Field) string {
+	source, _ := fieldBinding(field)
+	return source
+}
+
+// fieldBinding returns the source of field and the name of the parameter it
+// is read from. A source may name the parameter explicitly, as in
+// "header:X-Request-Id"; otherwise the name is derived from the field name.
+// Fields without a source of their own are bound as the google.api.http rules
+// of the methods taking their message map them.
+func fieldBinding(field *protogen.Field) (source string, name string) {
+	if option := fieldOption(field); option.Source != nil {
+		source = option.GetSource()
+	} else if match := sourceRegexp.FindStringSubmatch(string(field.Comments.Leading)); match != nil {
+		source = match[1]
+	} else if binding, _ := messageHTTPBinding(field.Parent); binding != nil {
+		return binding.source(field), string(field.Desc.Name())
+	}
+	source, name, _ = strings.Cut(source, ":")
+	if name != "" {
+		return source, name
+	}
+	switch source {
+	case sourcePath:
+		return source, Snake(field.GoName)
+	case sourceHeader:
+		return source, HeaderCase(string(field.Desc.Name()))
+	}
+	return source, string(field.Desc.Name())
+}
+
+// zeroCheck returns a Go expression which reports whether field of the message
+// named x holds its zero value.
+func zeroCheck(field *protogen.Field, x string) string {
+	return compareZero(field, x, true)
+}
+
+// nonZeroCheck returns a Go expression which reports whether field of the
+// message named x is set to a value other than its zero value.
+func nonZeroCheck(field *protogen.Field, x string) string {
+	return compareZero(field, x, false)
+}
+
+func compareZero(field *protogen.Field, x string, zero bool) string {
+	getter := x + ".Get" + field.GoName + "()"
+	equal, length, not := " == ", ") == 0", "!"
+	if !zero {
+		equal, length, not = " != ", ") > 0", ""
+	}
+	switch {
+	case field.Desc.IsList() || field.Desc.IsMap():
+		return "len(" + getter + length
+	case field.Desc.HasOptionalKeyword():
+		return x + "." + field.GoName + equal + "nil"
+	}
+	switch field.Desc.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return getter + equal + "nil"
+	case protoreflect.StringKind:
+		return getter + equal + "\"\""
+	case protoreflect.BytesKind:
+		return "len(" + getter + length
+	case protoreflect.BoolKind:
+		return not + getter
+	default:
+		return getter + equal + "0"
+	}
+}
+
+// isWrapper reports whether msg is one of the well-known wrapper types such as
+// google.protobuf.StringValue.
+func isWrapper(msg *protogen.Message) bool {
+	if msg == nil || msg.Desc.ParentFile().Package() != "google.protobuf" {
+		return false
+	}
+	switch msg.Desc.Name() {
+	case "DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value",
+		"UInt32Value", "BoolValue", "StringValue", "BytesValue":
+		return true
+	}
+	return false
+}
+
+// messageErrorf returns a diagnostic about msg naming its proto file.
+func messageErrorf(msg *protogen.Message, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: message %s: %s", msg.Desc.ParentFile().Path(), msg.Desc.FullName(), fmt.Sprintf(format, args...))
+}
+
+// fieldErrorf returns a diagnostic about field naming its proto file and
+// message.
+func fieldErrorf(field *protogen.Field, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: message %s, field %s: %s", field.Desc.ParentFile().Path(), field.Desc.ContainingMessage().FullName(), field.Desc.Name(), fmt.Sprintf(format, args...))
+}
+
+// fieldKind describes the type of field for diagnostics.
+func fieldKind(field *protogen.Field) string {
+	kind := field.Desc.Kind().String()
+	switch {
+	case field.Message != nil:
+		kind = string(field.Message.Desc.FullName())
+	case field.Enum != nil:
+		kind = string(field.Enum.Desc.FullName())
+	}
+	switch {
+	case field.Desc.IsMap():
+		return "map"
+	case field.Desc.IsList():
+		return "repeated " + kind
+	case field.Desc.HasOptionalKeyword() && field.Message == nil:
+		return "optional " + kind
+	}
+	return kind
+}
+
+// sameFieldType reports whether fields a and b have the same Go type, so that
+// the generated code can copy one into the other.
+func sameFieldType(a, b protoreflect.FieldDescriptor) bool {
+	switch {
+	case a.Kind() != b.Kind() || a.IsList() != b.IsList() || a.IsMap() != b.IsMap():
+		return false
+	case a.IsMap():
+		return sameFieldType(a.MapKey(), b.MapKey()) && sameFieldType(a.MapValue(), b.MapValue())
+	case a.Message() != nil:
+		return a.Message().FullName() == b.Message().FullName()
+	case a.Enum() != nil && a.Enum().FullName() != b.Enum().FullName():
+		return false
+	}
+	return a.IsList() || a.HasPresence() == b.HasPresence()
+}
+
 func hasBodyParams(fields []*protogen.Field) bool {
 	for _, field := range fields {
-		if strings.Contains(field.Comments.Leading.String(), "In: body") {
+		if fieldSource(field) == sourceBody && !isHTTPBody(field) {
 			return true
 		}
 	}
@@ -69,6 +412,20 @@ func hasBodyParams(fields []*protogen.Field) bool {
 	return false
 }
 
+// boundBinding returns the source and parameter name of field as BindFromFiber
+// binds it: the fields without a source are read by BodyParser when their
+// message has body parameters, and by QueryParser otherwise.
+func boundBinding(field *protogen.Field) (source string, name string) {
+	source, name = fieldBinding(field)
+	if source != "" {
+		return source, name
+	}
+	if hasBodyParams(field.Parent.Fields) {
+		return sourceBody, name
+	}
+	return sourceQuery, name
+}
+
 var (
 	slashSlash = []byte("//")
 	moduleStr  = []byte("module")
@@ -111,280 +468,199 @@ func ModulePath(mod []byte) string {
 	return "" // missing module path
 }
 
-func generateHelpers(gen *protogen.Plugin, file *protogen.File) *protogen.GeneratedFile {
+func generateHelpers(gen *protogen.Plugin, file *protogen.File, opts settings) *protogen.GeneratedFile {
 	filename := file.GeneratedFilenamePrefix + "_helpers.pb.go"
 
-	var pwd = os.Getenv("PWD")
-	moduleFile, err := os.ReadFile(fmt.Sprintf("%s/../../go.mod", pwd))
-	if err != nil {
-
-	}
-	var path = ModulePath(moduleFile)
-	var keeperPackage = protogen.GoImportPath(fmt.Sprintf("%s/internal/keeper", path))
-	var commonPackage = protogen.GoImportPath(fmt.Sprintf("%s/pkg/common", path))
-
 	g := gen.NewGeneratedFile(filename, file.GoImportPath)
 	g.P("// Code generated by protoc-gen-go-helpers. DO NOT EDIT.")
 	g.P()
 	g.P("package ", file.GoPackageName)
 	g.P()
+	checkDirectives(gen, file)
+	indexRequestMethods(gen)
 	for _, msg := range file.Messages {
 
 		const stringType = "string"
 		const uint32Type = "uint32"
-		options := msg.Desc.Options().(*descriptorpb.MessageOptions)
-		ext1 := proto.GetExtension(options, common.E_Parser).(*common.ParserOption)
-		if ext1 != nil {
-			g.P("//Fiber ", ext1.Fiber)
-			g.P("//Swag ", ext1.Swag)
-		}
-		/*var	po *common.ParserOption
-		options.ProtoReflect(). .Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
-			if !fd.IsExtension() {
-				return false
-			}
-			fmt.Println(fd, v)
-			g.P("//", fd, v)
-			// Make use of fd and v based on their reflective properties.
-			return true
-		})*/
-
-		if strings.Contains(string(msg.Comments.Trailing), "@feature:\"keeper=") {
+		parser := parserOption(msg)
 
-			re := regexp.MustCompile(`(?m)@feature:"keeper=(.*)"`)
-			for _, match := range re.FindAllStringSubmatch(string(msg.Comments.Trailing), -1) {
+		msgDirectives := commentDirectives(msg.Comments)
 
-				g.P("func (x *", msg.GoIdent, ") EncryptFields(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")), ", keepr ", g.QualifiedGoIdent(keeperPackage.Ident("Keeper")), ") {")
-				g.P("keepr.TransitEncrypt(ctx, x, \"", match[1], "\")")
-				g.P("}")
+		generateKeeper(gen, g, msg, opts)
 
-				g.P("func (x *", msg.GoIdent, ") DecryptFields(ctx ", g.QualifiedGoIdent(contextPackage.Ident("Context")), ", keepr ", g.QualifiedGoIdent(keeperPackage.Ident("Keeper")), ") {")
-				g.P("keepr.TransitDecrypt(ctx, x, \"", match[1], "\")")
-				g.P("}")
-			}
+		if parser.List || parser.Paging || parser.Cursor {
+			generateFilter(gen, g, msg, parser)
+			g.P()
+			generateOptions(gen, g, file, msg, parser, opts.pkgs)
+		}
+		if parser.Swag {
+			generateSwagParameters(g, msg)
+		}
+		if parser.SwagResponse {
+			generateSwagResponse(gen, g, msg)
+		}
+		if parser.Fiber && opts.fiberBinder {
+			generateFiberBinder(gen, g, msg)
+		}
+		if parser.Fiber && opts.httpBinder {
+			generateHTTPBinder(gen, g, msg, opts.pkgs.validation())
 		}
 
-		if strings.Contains(string(msg.Comments.Trailing), "@parser:\"list\"") {
-			g.P("func (x *", msg.GoIdent, ")  GetFilter() ", g.QualifiedGoIdent(protogen.GoIdent{GoName: "M", GoImportPath: "go.mongodb.org/mongo-driver/bson"}), " {")
-			g.P("query := bson.M{}")
+		for _, modelForMerge := range msgDirectives.values("pickFromArrayWPagination") {
 
-			for _, fld := range msg.Fields {
+			g.P()
 
-				if strings.Contains(string(fld.Comments.Leading), "@parser:\"filter\"") {
-					switch fld.Desc.Kind().String() {
-					case stringType:
-						g.P("if x.", fld.GoName, " != \"\" {")
-					case uint32Type:
-						g.P("if x.", fld.GoName, " != 0 {")
-					default:
-						g.P("if x.", fld.GoName, " != \"\" {")
+			commonPackage, err := opts.pkgs.common()
+			if err != nil {
+				gen.Error(messageErrorf(msg, "%v", err))
+				continue
+			}
+			g.P("func (x *", msg.GoIdent, ") PickFrom", modelForMerge, "(request []*", modelForMerge, ", pagination *", g.QualifiedGoIdent(commonPackage.Ident("Pagination")), ") {")
 
+			for _, field := range msg.Fields {
+				switch field.GoName {
+				case "Items":
+					if field.Desc.Kind() != protoreflect.MessageKind || !field.Desc.IsList() {
+						gen.Error(fieldErrorf(field, "%s field cannot hold the items picked from %s, only repeated message fields can", fieldKind(field), modelForMerge))
+						continue
+					}
+					g.P("if request == nil { return }")
+					g.P("var items =  make([]*", string(field.Desc.Message().Name()), ", 0)")
+					requestFields := getFieldsFromMessage(file.Messages, string(field.Desc.Message().Name()))
+					g.P("if len(request) > 0 {")
+					g.P("for _, req := range request{")
+					g.P("var item = new(", string(field.Desc.Message().Name()), ")")
+					for _, requestField := range requestFields {
+						entityField := getFieldFromMessage(file.Messages, modelForMerge, requestField.GoName)
+						if getFieldsFromMessage(file.Messages, modelForMerge) != nil && entityField == nil {
+							gen.Error(fieldErrorf(requestField, "no field %s in %s to pick from", requestField.GoName, modelForMerge))
+							continue
+						}
+						if entityField != nil && !sameFieldType(requestField.Desc, entityField.Desc) {
+							gen.Error(fieldErrorf(requestField, "%s field cannot be picked from the %s field of %s", fieldKind(requestField), fieldKind(entityField), modelForMerge))
+							continue
+						}
+						typeFromField := requestField.Desc.Kind().String()
+						if requestField.Desc.IsList() {
+							typeFromField = fmt.Sprintf("[]%s", typeFromField)
+						}
+						switch typeFromField {
+						case stringType:
+							g.P("if req.", requestField.GoName, " != \"\" {")
+							g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
+							g.P("}")
+						case uint32Type:
+							g.P("if req.", requestField.GoName, " != 0 {")
+							g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
+							g.P("}")
+						case "[]string", "[]uint32":
+							g.P("if len(req.", requestField.GoName, ") > 0 {")
+							g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
+							g.P("}")
+						default:
+							g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
+						}
 					}
-					g.P("query[\"", fld.Desc.Name(), "\"] = x.", fld.GoName)
+					g.P("items = append(items, item)")
+					g.P("}")
 					g.P("}")
+					g.P("x.Items = items")
+				case "Pagination":
+					g.P("x.Pagination = pagination")
 				}
-
 			}
 
-			g.P("return query")
-			g.P("}")
-			g.P()
-			g.P("func (x *", msg.GoIdent, ") GetOptions() *", g.QualifiedGoIdent(protogen.GoIdent{GoName: "FindOptions", GoImportPath: "go.mongodb.org/mongo-driver/mongo/options"}), " {")
-			g.P("var Options = &", g.QualifiedGoIdent(protogen.GoIdent{GoName: "FindOptions", GoImportPath: "go.mongodb.org/mongo-driver/mongo/options"}), "{}")
-			if strings.Contains(string(msg.Comments.Trailing), "paging:true") {
-				g.P("var limit int64 = 20")
-				g.P("if x.Limit > 0 {")
-				g.P("limit = x.Limit")
-				g.P("}")
-				g.P("Options.SetLimit(limit)")
-				g.P("Options.SetSkip(x.Skip)")
-				g.P("Options.SetSort(bson.M{\"_id\": 1})")
-			}
-			g.P("return Options")
-			g.P("}")
-		}
-		if strings.Contains(string(msg.Comments.Trailing), "@parser:\"swag\"") {
-			g.P(fmt.Sprintf("// swagger:parameters %sWrapper", Camel(msg.GoIdent.GoName)))
-			g.P("// ", msg.GoIdent.GoName, "Wrapper wrapper for ", msg.GoIdent.GoName)
-			g.P("type ", msg.GoIdent.GoName, "Wrapper struct {")
-			g.P("// In: body")
-			g.P("Body ", msg.GoIdent.GoName)
 			g.P("}")
 		}
-		if strings.Contains(string(msg.Comments.Trailing), "@parser:\"fiber\"") {
-			g.P("func (x *", msg.GoIdent, ") BindFromFiber(ctx *", g.QualifiedGoIdent(protogen.GoIdent{GoName: "Ctx", GoImportPath: "github.com/gofiber/fiber/v2"}), ") error {")
-			if len(msg.Fields) > 0 {
-				g.P("err := ctx.QueryParser(x)")
-				g.P("if err != nil {")
-				g.P("return err")
-				g.P("}")
-				if hasBodyParams(msg.Fields) {
-					g.P("err = ctx.BodyParser(x)")
-					g.P("if err != nil {")
-					g.P("return err")
-					g.P("}")
-				}
-			}
-			for _, field := range msg.Fields {
+		for _, modelForMerge := range msgDirectives.values("pickFrom") {
 
-				if strings.Contains(string(field.Comments.Leading), "In: context") {
-					ind := ""
-					if field.Desc.IsList() {
-						ind = "[]"
-					}
-					g.P("if ctx.Locals(\"", field.Desc.Name(), "\") != nil {")
-					g.P("x.", field.GoName, " = ctx.Locals(\"", field.Desc.Name(), "\").(", ind, field.Desc.Kind().String(), ")")
-					g.P("}")
+			requestFields := getFieldsFromMessage(file.Messages, msg.GoIdent.GoName)
+			g.P()
+
+			g.P("func (x *", msg.GoIdent, ") PickFrom", modelForMerge, "(request *", modelForMerge, ") {")
+			g.P("if request == nil { return }")
+			for _, requestField := range requestFields {
+				entityField := getFieldFromMessage(file.Messages, modelForMerge, requestField.GoName)
+				if entityField == nil {
+					continue
 				}
-				if strings.Contains(string(field.Comments.Leading), "In: path") {
-					snakedFieldName := Snake(field.GoName)
-					switch field.Desc.Kind().String() {
-					case uint32Type:
-						g.P(snakedFieldName, ", err := ctx.ParamsInt(\"", snakedFieldName, "\")")
-						g.P("if err != nil {")
-						g.P("return err")
-						g.P("}")
-						g.P("x.", field.GoName, " = uint32(", snakedFieldName, ")")
-					default:
-						g.P("ERROR NON PARSABLE TYPE ", field.Desc.Kind().String())
-					}
+				if !sameFieldType(requestField.Desc, entityField.Desc) {
+					gen.Error(fieldErrorf(requestField, "%s field cannot be picked from the %s field of %s", fieldKind(requestField), fieldKind(entityField), modelForMerge))
+					continue
+				}
+				typeFromField := requestField.Desc.Kind().String()
+				if requestField.Desc.IsList() {
+					typeFromField = fmt.Sprintf("[]%s", typeFromField)
+				}
+				switch typeFromField {
+				case stringType:
+					g.P("if request.", requestField.GoName, " != \"\" {")
+					g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+					g.P("}")
+				case uint32Type:
+					g.P("if request.", requestField.GoName, " != 0 {")
+					g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+					g.P("}")
+				case "[]string", "[]uint32":
+					g.P("if len(request.", requestField.GoName, ") > 0 {")
+					g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+					g.P("}")
+				default:
+					g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
 				}
 			}
-			g.P("return nil")
 			g.P("}")
 		}
+		for _, merge := range msgDirectives.values("merge") {
+			requests, target, _ := strings.Cut(merge, "|")
+			modelsForMerge := strings.Split(requests, ",")
+			for _, modelForMerge := range modelsForMerge {
 
-		if strings.Contains(string(msg.Comments.Trailing), "@pickFromArrayWPagination:") {
-			re := regexp.MustCompile(`(?m)@pickFromArrayWPagination:"(.*)"`)
-			for _, match := range re.FindAllStringSubmatch(string(msg.Comments.Trailing), -1) {
-				modelForMerge := match[1]
-
+				requestFields := getFieldsFromMessage(file.Messages, modelForMerge)
 				g.P()
 
-				g.P("func (x *", msg.GoIdent, ") PickFrom", modelForMerge, "(request []*", modelForMerge, ", pagination *", g.QualifiedGoIdent(commonPackage.Ident("Pagination")), ") {")
-
-				for _, field := range msg.Fields {
-					switch field.GoName {
-					case "Items":
-						g.P("if request == nil { return }")
-						g.P("var items =  make([]*", string(field.Desc.Message().Name()), ", 0)")
-						requestFields := getFieldsFromMessage(file.Messages, string(field.Desc.Message().Name()))
-						g.P("if len(request) > 0 {")
-						g.P("for _, req := range request{")
-						g.P("var item = new(", string(field.Desc.Message().Name()), ")")
-						for _, requestField := range requestFields {
-							typeFromField := requestField.Desc.Kind().String()
-							if requestField.Desc.IsList() {
-								typeFromField = fmt.Sprintf("[]%s", typeFromField)
-							}
-							switch typeFromField {
-							case stringType:
-								g.P("if req.", requestField.GoName, " != \"\" {")
-								g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
-								g.P("}")
-							case uint32Type:
-								g.P("if req.", requestField.GoName, " != 0 {")
-								g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
-								g.P("}")
-							case "[]string", "[]uint32":
-								g.P("if len(req.", requestField.GoName, ") > 0 {")
-								g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
-								g.P("}")
-							default:
-								g.P("item.", requestField.GoName, " = req.Get", requestField.GoName, "()")
-							}
+				g.P("func (x *", Pascal(target), ") MergeFrom", modelForMerge, "(request *", modelForMerge, ") {")
+				g.P("if x == nil { return }")
+				for _, requestField := range requestFields {
+					if fieldSource(requestField) == sourceBody {
+						targetField := getFieldFromMessage(file.Messages, target, requestField.GoName)
+						if getFieldsFromMessage(file.Messages, target) != nil && targetField == nil {
+							gen.Error(fieldErrorf(requestField, "no field %s in %s to merge into", requestField.GoName, target))
+							continue
+						}
+						if targetField != nil && !sameFieldType(requestField.Desc, targetField.Desc) {
+							gen.Error(fieldErrorf(requestField, "%s field cannot be merged into the %s field of %s", fieldKind(requestField), fieldKind(targetField), target))
+							continue
+						}
+						typeFromField := requestField.Desc.Kind().String()
+						if requestField.Desc.IsList() {
+							typeFromField = fmt.Sprintf("[]%s", typeFromField)
+						}
+						switch typeFromField {
+						case stringType:
+							g.P("if request.", requestField.GoName, " != \"\" {")
+							g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+							g.P("}")
+						case uint32Type:
+							g.P("if request.", requestField.GoName, " != 0 {")
+							g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+							g.P("}")
+						case "[]string", "[]uint32":
+							g.P("if len(request.", requestField.GoName, ") > 0 {")
+							g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
+							g.P("}")
+						default:
+							g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
 						}
-						g.P("items = append(items, item)")
-						g.P("}")
-						g.P("}")
-						g.P("x.Items = items")
-					case "Pagination":
-						g.P("x.Pagination = pagination")
-					}
-				}
-
-				g.P("}")
-			}
-		}
-		if strings.Contains(string(msg.Comments.Trailing), "@pickFrom:") {
-			re := regexp.MustCompile(`(?m)@pickFrom:"(.*)"`)
-			for _, match := range re.FindAllStringSubmatch(string(msg.Comments.Trailing), -1) {
-				modelForMerge := match[1]
-
-				requestFields := getFieldsFromMessage(file.Messages, msg.GoIdent.GoName)
-				g.P()
 
-				g.P("func (x *", msg.GoIdent, ") PickFrom", modelForMerge, "(request *", modelForMerge, ") {")
-				g.P("if request == nil { return }")
-				for _, requestField := range requestFields {
-					entityField := getFieldFromMessage(file.Messages, modelForMerge, requestField.GoName)
-					if entityField == nil {
-						continue
-					}
-					typeFromField := requestField.Desc.Kind().String()
-					if requestField.Desc.IsList() {
-						typeFromField = fmt.Sprintf("[]%s", typeFromField)
-					}
-					switch typeFromField {
-					case stringType:
-						g.P("if request.", requestField.GoName, " != \"\" {")
-						g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-						g.P("}")
-					case uint32Type:
-						g.P("if request.", requestField.GoName, " != 0 {")
-						g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-						g.P("}")
-					case "[]string", "[]uint32":
-						g.P("if len(request.", requestField.GoName, ") > 0 {")
-						g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-						g.P("}")
-					default:
-						g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
 					}
 				}
 				g.P("}")
 			}
 		}
-		if strings.Contains(string(msg.Comments.Trailing), "@merge:") {
-			re := regexp.MustCompile(`(?m)@merge:"(.*)\|(.*)"`)
-			for _, match := range re.FindAllStringSubmatch(string(msg.Comments.Trailing), -1) {
-				modelsForMerge := strings.Split(match[1], ",")
-				for _, modelForMerge := range modelsForMerge {
 
-					requestFields := getFieldsFromMessage(file.Messages, modelForMerge)
-					g.P()
-
-					g.P("func (x *", Pascal(match[2]), ") MergeFrom", modelForMerge, "(request *", modelForMerge, ") {")
-					g.P("if x == nil { return }")
-					for _, requestField := range requestFields {
-						if strings.Contains(requestField.Comments.Leading.String(), "In: body") {
-							typeFromField := requestField.Desc.Kind().String()
-							if requestField.Desc.IsList() {
-								typeFromField = fmt.Sprintf("[]%s", typeFromField)
-							}
-							switch typeFromField {
-							case stringType:
-								g.P("if request.", requestField.GoName, " != \"\" {")
-								g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-								g.P("}")
-							case uint32Type:
-								g.P("if request.", requestField.GoName, " != 0 {")
-								g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-								g.P("}")
-							case "[]string", "[]uint32":
-								g.P("if len(request.", requestField.GoName, ") > 0 {")
-								g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-								g.P("}")
-							default:
-								g.P("x.", requestField.GoName, " = request.Get", requestField.GoName, "()")
-							}
-
-						}
-					}
-					g.P("}")
-				}
-			}
-		}
+		generateValidate(gen, g, msg, opts.pkgs.validation())
+		generateFieldTags(g, msg)
 
 		g.P()
 
@@ -409,9 +685,37 @@ func generateHelpers(gen *protogen.Plugin, file *protogen.File) *protogen.Genera
 		g.P("return nil")
 		g.P("}")
 	}
+	if opts.fiberBinder {
+		generateRoutes(gen, g, file, opts.pkgs.validation())
+	}
 	return g
 }
 
+func generateFieldTags(g *protogen.GeneratedFile, msg *protogen.Message) {
+	var tagged []*protogen.Field
+	for _, field := range msg.Fields {
+		if fieldOption(field).GetTags() != "" {
+			tagged = append(tagged, field)
+		}
+	}
+	if len(tagged) == 0 {
+		return
+	}
+
+	structTag := g.QualifiedGoIdent(reflectPackage.Ident("StructTag"))
+	g.P()
+	g.P("var _", msg.GoIdent.GoName, "_fieldTags = map[string]", structTag, "{")
+	for _, field := range tagged {
+		g.P(strconv.Quote(string(field.Desc.Name())), ": ", strconv.Quote(fieldOption(field).GetTags()), ",")
+	}
+	g.P("}")
+	g.P()
+	g.P("// FieldTag returns the tags declared by the field_option of the named field.")
+	g.P("func (x *", msg.GoIdent, ") FieldTag(name string) ", structTag, " {")
+	g.P("return _", msg.GoIdent.GoName, "_fieldTags[name]")
+	g.P("}")
+}
+
 const (
 	INITIAL_STATE                 = iota
 	EXPECT_FOLLOWING_SMALL_LETTER = iota
@@ -579,3 +883,12 @@ func Pascal(s string) string {
 func Snake(s string) string {
 	return NewLowerProcessor('_').Convert(s)
 }
+
+func HeaderCase(s string) string {
+	return NewProcessor(&CaseTranslator{
+		FirstLetter:       unicode.ToUpper,
+		LetterInWord:      unicode.ToLower,
+		FirstLetterOfWord: unicode.ToUpper,
+		Separator:         '-',
+	}).Convert(s)
+}
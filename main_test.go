@@ -1,15 +1,783 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"regexp"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+
+	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
 )
 
 func TestParseMerge(t *testing.T) {
-	line := "message AdminJetonUpdateRequest {// @parser:\"fiber\",@parser:\"swag\",@merge:\"AdminJetonUpdateRequest|JetonEntity\""
-	re := regexp.MustCompile(`(?m)@merge:"(.*)\|(.*)"`)
-	for _, match := range re.FindAllStringSubmatch(line, -1) {
-		fmt.Println(match[2])
+	line := "message AdminJetonUpdateRequest {// @parser:\"fiber\",@parser:\"swag\",@merge:\"AdminJetonUpdateRequest|JetonEntity\",@pickFrom:\"JetonEntity\""
+	directives, err := parseDirectives(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merge, ok := directives.value("merge")
+	if !ok {
+		t.Fatal("no @merge directive")
+	}
+	if request, target, _ := strings.Cut(merge, "|"); request != "AdminJetonUpdateRequest" || target != "JetonEntity" {
+		t.Errorf("@merge = %q, want AdminJetonUpdateRequest|JetonEntity", merge)
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	for comment, want := range map[string]string{
+		``:                                `[]`,
+		` @parser:"fiber",@parser:"swag"`: `[{parser fiber} {parser swag}]`,
+		` @parser:"list",paging:true,@limit:"max=5"`:     `[{parser list} {paging true} {limit max=5}]`,
+		` @parser:"filter,op=gte,field=created_at"`:      `[{parser filter,op=gte,field=created_at}]`,
+		` @route:"GET /items/:id" the route`:             `[{route GET /items/:id}]`,
+		` mail admin@example.com, @deprecated; In: path`: `[]`,
+		` @gotags: validate:"required"`:                  `[]`,
+		` @mergeInto:"A|B" @sort:"name"`:                 `[{mergeInto A|B} {sort name}]`,
+		" @sort:\"a\"\n @sort:\"b\"":                     `[{sort a} {sort b}]`,
+	} {
+		directives, err := parseDirectives(comment)
+		if err != nil {
+			t.Errorf("parseDirectives(%q): %v", comment, err)
+			continue
+		}
+		if got := fmt.Sprint([]directive(directives)); got != want {
+			t.Errorf("parseDirectives(%q) = %s, want %s", comment, got, want)
+		}
+	}
+	for _, comment := range []string{` @parser:fiber`, ` @merge:"A|B`} {
+		if _, err := parseDirectives(comment); err == nil {
+			t.Errorf("parseDirectives(%q) succeeded", comment)
+		}
+	}
+}
+
+func TestCheckComments(t *testing.T) {
+	for comment, want := range map[string]string{
+		` @parser:"fiber",@merge:"A,B|C"`: ``,
+		` @parser:"fibre"`:                `directive @parser:"fibre": must be one of fiber, swag, swag-response, list`,
+		` @gotags: validate:"required"`:   ``,
+		` @parsr:"fiber"`:                 `unknown directive @parsr`,
+		` @route:"GET /items"`:            `directive @route does not apply here`,
+		` @merge:"A"`:                     `directive @merge:"A": must be Request|Target`,
+		` @limit:"max=ten"`:               `directive @limit:"max=ten": max must be a positive integer`,
+		` @sort:"name`:                    `directive @sort: unterminated value`,
+	} {
+		err := checkComments(protogen.CommentSet{Trailing: protogen.Comments(comment)}, messageDirectiveChecks)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("checkComments(%q) = %q, want %q", comment, got, want)
+		}
+	}
+}
+
+func TestForeignDirectives(t *testing.T) {
+	gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name:  proto.String("FileRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{testField("path", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil)},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+			Path:             []int32{4, 0, 2, 0},
+			Span:             []int32{0, 0, 0},
+			TrailingComments: proto.String(` @gotags: validate:"required"`),
+		}}},
+	})
+	generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{})
+
+	if err := gen.Response().GetError(); err != "" {
+		t.Errorf("error = %q, want none", err)
+	}
+}
+
+func TestNestedDirectives(t *testing.T) {
+	gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Outer"),
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name:  proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{testField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil)},
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+			Path:            []int32{4, 0, 3, 0, 2, 0},
+			Span:            []int32{0, 0, 0},
+			LeadingComments: proto.String(` @parsr:"filter"`),
+		}}},
+	})
+	generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{})
+
+	want := "test.proto: message test.Outer.Inner, field name: unknown directive @parsr"
+	if got := gen.Response().GetError(); got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+// newTestPlugin builds a plugin for a single test.proto file which imports
+// common.proto.
+func newTestPlugin(t *testing.T, messages ...*descriptorpb.DescriptorProto) *protogen.Plugin {
+	t.Helper()
+	return newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{MessageType: messages})
+}
+
+// newTestFilePlugin builds a plugin for file, named test.proto.
+func newTestFilePlugin(t *testing.T, file *descriptorpb.FileDescriptorProto) *protogen.Plugin {
+	t.Helper()
+	file.Name = proto.String("test.proto")
+	file.Package = proto.String("test")
+	file.Syntax = proto.String("proto3")
+	file.Dependency = []string{"common.proto"}
+	file.Options = &descriptorpb.FileOptions{GoPackage: proto.String("example.com/test;test")}
+	gen, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"test.proto"},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+			protodesc.ToFileDescriptorProto(common.File_common_proto),
+			file,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+// testField builds a field of a test message, with the field option option
+// unless it is nil.
+func testField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, option *common.ModelFieldOption) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), JsonName: proto.String(name)}
+	if option != nil {
+		field.Options = &descriptorpb.FieldOptions{}
+		proto.SetExtension(field.Options, common.E_FieldOption, option)
+	}
+	return field
+}
+
+func TestParserOption(t *testing.T) {
+	options := &descriptorpb.MessageOptions{}
+	proto.SetExtension(options, common.E_Parser, &common.ParserOption{Fiber: true, Paging: true})
+	gen := newTestPlugin(t,
+		&descriptorpb.DescriptorProto{Name: proto.String("WithOption"), Options: options},
+		&descriptorpb.DescriptorProto{Name: proto.String("WithoutOption")},
+	)
+	messages := gen.Files[len(gen.Files)-1].Messages
+
+	parser := parserOption(messages[0])
+	if !parser.Fiber || parser.Swag || !parser.Paging {
+		t.Errorf("parserOption(WithOption) = %v", parser)
+	}
+	parser = parserOption(messages[1])
+	if parser.Fiber || parser.Swag || parser.Paging || parser.List {
+		t.Errorf("parserOption(WithoutOption) = %v", parser)
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("ListRequest")}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+			Path:            []int32{4, 0},
+			Span:            []int32{0, 0, 0},
+			LeadingComments: proto.String(` @parser:"list" paging:true @limit:"default=ten"`),
+		}}},
+	})
+	file := gen.Files[len(gen.Files)-1]
+	if parser := parserOption(file.Messages[0]); parser.DefaultLimit != 0 {
+		t.Errorf("parserOption().DefaultLimit = %d, want 0", parser.DefaultLimit)
+	}
+	generateHelpers(gen, file, settings{})
+
+	want := `test.proto: message test.ListRequest: directive @limit:"default=ten": default must be a positive integer`
+	if got := gen.Response().GetError(); got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestCopyTypeErrors(t *testing.T) {
+	item := testField("items", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil)
+	item.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	optionalName := testField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil)
+	optionalName.Proto3Optional = proto.Bool(true)
+	optionalName.OneofIndex = proto.Int32(0)
+	for _, test := range []struct {
+		directive string
+		message   *descriptorpb.DescriptorProto
+		want      string
+	}{{
+		directive: ` @pickFromArrayWPagination:"Entity"`,
+		message:   &descriptorpb.DescriptorProto{Name: proto.String("Response"), Field: []*descriptorpb.FieldDescriptorProto{item}},
+		want:      "test.proto: message test.Response, field items: repeated string field cannot hold the items picked from Entity, only repeated message fields can",
+	}, {
+		directive: ` @pickFrom:"Entity"`,
+		message: &descriptorpb.DescriptorProto{
+			Name:      proto.String("Response"),
+			Field:     []*descriptorpb.FieldDescriptorProto{optionalName},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("_name")}},
+		},
+		want: "test.proto: message test.Response, field name: optional string field cannot be picked from the string field of Entity",
+	}, {
+		directive: ` @merge:"Response|Entity"`,
+		message: &descriptorpb.DescriptorProto{
+			Name:  proto.String("Response"),
+			Field: []*descriptorpb.FieldDescriptorProto{testField("count", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{Source: proto.String("body")})},
+		},
+		want: "test.proto: message test.Response, field count: string field cannot be merged into the int32 field of Entity",
+	}} {
+		gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+			MessageType: []*descriptorpb.DescriptorProto{test.message, {
+				Name: proto.String("Entity"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					testField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+					testField("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, nil),
+				},
+			}},
+			SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:            []int32{4, 0},
+				Span:            []int32{0, 0, 0},
+				LeadingComments: proto.String(test.directive),
+			}}},
+		})
+		generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{pkgs: newPackages("", "", "example.com/common", "")})
+
+		if got := gen.Response().GetError(); got != test.want {
+			t.Errorf("%s: error = %q, want %q", test.directive, got, test.want)
+		}
+	}
+}
+
+func TestFieldOption(t *testing.T) {
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+		Name: proto.String("Request"),
+		Field: []*descriptorpb.FieldDescriptorProto{testField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{
+			Source:     proto.String("body"),
+			IsRequired: proto.Bool(true),
+			Validate:   proto.String("required, min=3,max=64"),
+		})},
+	})
+	field := gen.Files[len(gen.Files)-1].Messages[0].Fields[0]
+
+	if source := fieldSource(field); source != sourceBody {
+		t.Errorf("fieldSource() = %q, want %q", source, sourceBody)
+	}
+	got := fmt.Sprint(validateRules(field))
+	if want := "[{required } {min 3} {max 64}]"; got != want {
+		t.Errorf("validateRules() = %s, want %s", got, want)
+	}
+}
+
+func TestFindModulePath(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "api", "v1")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findModulePath(dir); err == nil {
+		t.Error("findModulePath() without go.mod succeeded")
+	}
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/project\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := findModulePath(dir)
+	if err != nil || path != "example.com/project" {
+		t.Errorf("findModulePath() = %q, %v, want %q", path, err, "example.com/project")
+	}
+}
+
+func TestPluginModule(t *testing.T) {
+	gen := newTestPlugin(t)
+	gen.Request.Parameter = proto.String("module=example.com/a,keeper_legacy=true")
+	if got := pluginModule(gen, ""); got != "example.com/a" {
+		t.Errorf("pluginModule() = %q, want the module parameter", got)
+	}
+	if got := pluginModule(gen, "example.com/b"); got != "example.com/b" {
+		t.Errorf("pluginModule() = %q, want the module_path parameter", got)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	if got, err := newPackages("example.com/project", "", "", "").keeper(); err != nil || got != "example.com/project/internal/keeper" {
+		t.Errorf("keeper() = %q, %v", got, err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Without a module, only the paths which are needed and not given fail.
+	pkgs := newPackages("", "example.com/keeper", "", "")
+	if got, err := pkgs.keeper(); err != nil || got != "example.com/keeper" {
+		t.Errorf("keeper() = %q, %v", got, err)
+	}
+	if _, err := pkgs.common(); err == nil {
+		t.Error("common() without a module succeeded")
+	}
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{Name: proto.String("Request")})
+	generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{pkgs: newPackages("", "", "", "")})
+	if err := gen.Response().Error; err != nil {
+		t.Errorf("generating without references to the packages failed: %s", *err)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	keys, err := parseSort("created_at:desc, name,_id:ASC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(keys), "[{created_at -1} {name 1} {_id 1}]"; got != want {
+		t.Errorf("parseSort() = %s, want %s", got, want)
+	}
+	if _, err := parseSort("name:up"); err == nil {
+		t.Error("parseSort() with an invalid direction succeeded")
+	}
+}
+
+func TestNestedValidate(t *testing.T) {
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+		Name: proto.String("Outer"),
+		NestedType: []*descriptorpb.DescriptorProto{{
+			Name:  proto.String("Inner"),
+			Field: []*descriptorpb.FieldDescriptorProto{testField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{IsRequired: proto.Bool(true)})},
+		}},
+	})
+	content, err := generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{pkgs: newPackages("", "", "", "example.com/validation")}).Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"func (x *Outer_Inner) Validate() error {", "\"example.com/validation\""} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("generated code lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestUnsupportedFieldError(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{Fiber: true})
+	inner := testField("inner", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, &common.ModelFieldOption{Source: proto.String("path")})
+	inner.TypeName = proto.String(".test.Inner")
+	gen := newTestPlugin(t,
+		&descriptorpb.DescriptorProto{Name: proto.String("Inner")},
+		&descriptorpb.DescriptorProto{
+			Name:    proto.String("Request"),
+			Options: messageOptions,
+			Field:   []*descriptorpb.FieldDescriptorProto{inner},
+		},
+	)
+	generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{fiberBinder: true})
+
+	want := "test.proto: message test.Request, field inner: test.Inner fields cannot be parsed from a string"
+	if got := gen.Response().GetError(); got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestFileSiblingError(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{Fiber: true})
+	gen := newTestPlugin(t,
+		&descriptorpb.DescriptorProto{
+			Name:    proto.String("Upload"),
+			Options: messageOptions,
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("file", 1, descriptorpb.FieldDescriptorProto_TYPE_BYTES, &common.ModelFieldOption{
+					Source:        proto.String("formData"),
+					FilenameField: proto.String("name"),
+				}),
+				testField("name", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, nil),
+			},
+		},
+	)
+	generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{fiberBinder: true})
+
+	want := "test.proto: message test.Upload, field file: name must be a string field"
+	if got := gen.Response().GetError(); got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+func TestParseHTTPRule(t *testing.T) {
+	var custom, binding, rule []byte
+	custom = protowire.AppendTag(custom, 1, protowire.BytesType)
+	custom = protowire.AppendString(custom, "head")
+	custom = protowire.AppendTag(custom, 2, protowire.BytesType)
+	custom = protowire.AppendString(custom, "/v1/items/{id}")
+	binding = protowire.AppendTag(binding, 8, protowire.BytesType)
+	binding = protowire.AppendBytes(binding, custom)
+	rule = protowire.AppendTag(rule, 4, protowire.BytesType)
+	rule = protowire.AppendString(rule, "/v1/items")
+	rule = protowire.AppendTag(rule, 7, protowire.BytesType)
+	rule = protowire.AppendString(rule, "*")
+	rule = protowire.AppendTag(rule, 11, protowire.BytesType)
+	rule = protowire.AppendBytes(rule, binding)
+
+	got, err := parseHTTPRule(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.method != "POST" || got.path != "/v1/items" || got.body != "*" || len(got.bindings) != 1 {
+		t.Fatalf("parseHTTPRule() = %+v", got)
+	}
+	if b := got.bindings[0]; b.method != "HEAD" || b.path != "/v1/items/{id}" {
+		t.Errorf("parseHTTPRule() binding = %+v", b)
+	}
+}
+
+func TestFiberPath(t *testing.T) {
+	for template, want := range map[string]string{
+		"/v1/items":                  "/v1/items",
+		"/v1/items/{id}":             "/v1/items/:id",
+		"/v1/shelves/{shelf=*}/{id}": "/v1/shelves/:shelf/:id",
+		"/v1/items/{id}:archive":     "/v1/items/:id\\:archive",
+	} {
+		if got, err := fiberPath(template); err != nil || got != want {
+			t.Errorf("fiberPath(%q) = %q, %v, want %q", template, got, err, want)
+		}
+	}
+	for _, template := range []string{"/v1/{name=shelves/*}", "/v1/items/{item.id}", "/v1/items/{id"} {
+		if _, err := fiberPath(template); err == nil {
+			t.Errorf("fiberPath(%q) succeeded", template)
+		}
+	}
+}
+
+func TestMessageHTTPBinding(t *testing.T) {
+	var rule []byte
+	rule = protowire.AppendTag(rule, 6, protowire.BytesType)
+	rule = protowire.AppendString(rule, "/v1/items/{id}")
+	rule = protowire.AppendTag(rule, 7, protowire.BytesType)
+	rule = protowire.AppendString(rule, "item")
+	var unknown []byte
+	unknown = protowire.AppendTag(unknown, httpRuleField, protowire.BytesType)
+	unknown = protowire.AppendBytes(unknown, rule)
+	options := &descriptorpb.MethodOptions{}
+	options.ProtoReflect().SetUnknown(unknown)
+
+	gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("UpdateRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT64, nil),
+				testField("item", 2, descriptorpb.FieldDescriptorProto_TYPE_BYTES, nil),
+				testField("mask", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Items"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Update"),
+				InputType:  proto.String(".test.UpdateRequest"),
+				OutputType: proto.String(".test.UpdateRequest"),
+				Options:    options,
+			}},
+		}},
+	})
+	msg := gen.Files[len(gen.Files)-1].Messages[0]
+
+	for i, want := range []string{sourcePath, sourceBody, sourceQuery} {
+		if source := fieldSource(msg.Fields[i]); source != want {
+			t.Errorf("fieldSource(%s) = %q, want %q", msg.Fields[i].Desc.Name(), source, want)
+		}
+	}
+	if !isHTTPBody(msg.Fields[1]) {
+		t.Error("isHTTPBody(item) = false")
+	}
+}
+
+func TestBinderSettings(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{Fiber: true})
+	for _, opts := range []settings{{fiberBinder: true}, {httpBinder: true}, {fiberBinder: true, httpBinder: true}} {
+		gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+			Name:    proto.String("Request"),
+			Options: messageOptions,
+			Field:   []*descriptorpb.FieldDescriptorProto{testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32, nil)},
+		})
+		content, err := generateHelpers(gen, gen.Files[len(gen.Files)-1], opts).Content()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.Contains(content, []byte(") BindFromFiber(")); got != opts.fiberBinder {
+			t.Errorf("%+v: BindFromFiber generated = %v", opts, got)
+		}
+		if got := bytes.Contains(content, []byte(") BindFromHTTP(")); got != opts.httpBinder {
+			t.Errorf("%+v: BindFromHTTP generated = %v", opts, got)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{Fiber: true})
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+		Name:    proto.String("Request"),
+		Options: messageOptions,
+		Field: []*descriptorpb.FieldDescriptorProto{
+			testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32, &common.ModelFieldOption{Source: proto.String("path"), IsRequired: proto.Bool(true)}),
+		},
+	})
+	file := gen.Files[len(gen.Files)-1]
+	generateManifest(gen, file, generateHelpers(gen, file, settings{fiberBinder: true}))
+
+	var got manifest
+	for _, out := range gen.Response().GetFile() {
+		if strings.HasSuffix(out.GetName(), "test_helpers.manifest.json") {
+			if err := json.Unmarshal([]byte(out.GetContent()), &got); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(got.Messages) != 1 {
+		t.Fatalf("manifest messages = %+v", got.Messages)
+	}
+	msg := got.Messages[0]
+	var parser bytes.Buffer
+	if err := json.Compact(&parser, msg.Parser); err != nil || msg.Name != "test.Request" || parser.String() != `{"fiber":true}` {
+		t.Errorf("manifest message = %s %s", msg.Name, msg.Parser)
+	}
+	if got, want := fmt.Sprint(msg.Methods), "[BindFromFiber Validate MustMarshalBinary MarshalBinary UnmarshalBinary]"; got != want {
+		t.Errorf("manifest methods = %s, want %s", got, want)
+	}
+	if len(msg.Fields) != 1 || msg.Fields[0].Source != "path" || msg.Fields[0].Param != "id" || fmt.Sprint(msg.Fields[0].Validate) != "[required]" {
+		t.Errorf("manifest fields = %+v", msg.Fields)
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/v1/items":              "/v1/items",
+		"/v1/items/:id":          "/v1/items/{id}",
+		"/v1/items/:id\\:move":   "/v1/items/{id}:move",
+		"/v1/shelves/:shelf/:id": "/v1/shelves/{shelf}/{id}",
+	} {
+		if got := openAPIPath(path); got != want {
+			t.Errorf("openAPIPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	comment := func(path []int32, text string) *descriptorpb.SourceCodeInfo_Location {
+		return &descriptorpb.SourceCodeInfo_Location{Path: path, Span: []int32{0, 0, 0}, LeadingComments: proto.String(text)}
+	}
+	status := testField("status", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, nil)
+	status.TypeName = proto.String(".test.Status")
+	file := &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("GetRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT64, nil),
+				testField("user", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+				status,
+			},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Items"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Get"),
+				InputType:  proto.String(".test.GetRequest"),
+				OutputType: proto.String(".test.GetRequest"),
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{
+			comment([]int32{4, 0}, " A request.\n"),
+			comment([]int32{4, 0, 2, 0}, " The item.\n In: path\n required: true\n"),
+			comment([]int32{4, 0, 2, 1}, " In: context\n"),
+			comment([]int32{6, 0, 2, 0}, " @route:\"GET /items/:id\"\n"),
+		}},
+	}
+	document := func(opts settings) openAPIDocument {
+		gen := newTestFilePlugin(t, file)
+		generateOpenAPI(gen, opts)
+		var doc openAPIDocument
+		for _, out := range gen.Response().GetFile() {
+			if strings.HasSuffix(out.GetName(), "/test.openapi.json") {
+				if err := json.Unmarshal([]byte(out.GetContent()), &doc); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return doc
+	}
+	got := document(settings{fiberBinder: true})
+	if got.OpenAPI != openAPIVersion || got.Info.Title != "test" {
+		t.Fatalf("document = %+v", got)
+	}
+	request := got.Components.Schemas["test.GetRequest"]
+	if request == nil || request.Description != "A request." || fmt.Sprint(request.Required) != "[id]" || request.Properties["id"].Description != "The item." {
+		t.Errorf("GetRequest schema = %+v", request)
+	}
+	if enum := got.Components.Schemas["test.Status"]; enum == nil || fmt.Sprint(enum.Enum, enum.EnumNames) != "[0 1] [UNKNOWN ACTIVE]" {
+		t.Errorf("Status schema = %+v", enum)
+	}
+	op := got.Paths["/items/{id}"]["get"]
+	if op == nil {
+		t.Fatalf("paths = %+v", got.Paths)
+	}
+	// The context field is left out, the status is read from the query.
+	if len(op.Parameters) != 2 || op.Parameters[0] != (openAPIParameter{Name: "id", In: "path", Description: "The item.", Required: true, Schema: op.Parameters[0].Schema}) || op.Parameters[1].Name != "status" || op.Parameters[1].In != "query" {
+		t.Errorf("parameters = %+v", op.Parameters)
+	}
+	if op.OperationID != "Items_Get" || op.RequestBody != nil {
+		t.Errorf("operation = %+v", op)
+	}
+
+	// Without the Fiber binder, no routes are generated to document.
+	got = document(settings{})
+	if len(got.Paths) != 0 || got.Components.Schemas["test.GetRequest"] == nil {
+		t.Errorf("document without routes = %+v", got)
+	}
+}
+
+func TestSwagResponse(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{SwagResponse: true})
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+		Name:    proto.String("ListResponse"),
+		Options: messageOptions,
+		Field: []*descriptorpb.FieldDescriptorProto{
+			testField("total", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, &common.ModelFieldOption{Source: proto.String("header:X-Total-Count")}),
+		},
+	})
+	content, err := generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{}).Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// swagger:response ListResponse\n",
+		"type ListResponseResponseWrapper struct {\n",
+		"// in: header\n\tTotal int64 `json:\"X-Total-Count\"`\n",
+		"// in: body\n\tBody *ListResponse\n",
+	} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("generated code lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestSwagParameters(t *testing.T) {
+	messageOptions := &descriptorpb.MessageOptions{}
+	proto.SetExtension(messageOptions, common.E_Parser, &common.ParserOption{Swag: true})
+	const stringType = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	gen := newTestPlugin(t, &descriptorpb.DescriptorProto{
+		Name:    proto.String("UpdateRequest"),
+		Options: messageOptions,
+		Field: []*descriptorpb.FieldDescriptorProto{
+			testField("id", 1, stringType, &common.ModelFieldOption{Source: proto.String("path")}),
+			testField("trace", 2, stringType, &common.ModelFieldOption{Source: proto.String("header:X-Trace")}),
+			testField("user", 3, stringType, &common.ModelFieldOption{Source: proto.String("context")}),
+			testField("name", 4, stringType, &common.ModelFieldOption{Source: proto.String("body"), IsRequired: proto.Bool(true)}),
+		},
+	})
+	content, err := generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{}).Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// swagger:parameters updateRequestWrapper\n",
+		"// in: path\n\t// required: true\n\tId string `json:\"id\"`\n",
+		"// in: header\n\tTrace string `json:\"X-Trace\"`\n",
+		"// in: body\n\tBody struct {\n\t\t// required: true\n\t\tName string `json:\"name\"`\n\t}\n",
+	} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("generated code lacks %q:\n%s", want, content)
+		}
+	}
+	if bytes.Contains(content, []byte("User string")) {
+		t.Errorf("generated code documents the context field:\n%s", content)
+	}
+}
+
+func TestEncryptedFields(t *testing.T) {
+	tags := testField("tags", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{Encrypted: proto.Bool(true), TransitKey: proto.String("tags")})
+	tags.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Account"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32, nil),
+				testField("iban", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{Encrypted: proto.Bool(true)}),
+				testField("document", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES, &common.ModelFieldOption{Encrypted: proto.Bool(true), TransitKey: proto.String("documents")}),
+			},
+		}, {
+			Name: proto.String("Keyless"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("iban", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, &common.ModelFieldOption{Encrypted: proto.Bool(true)}),
+			},
+		}, {
+			Name:  proto.String("Repeated"),
+			Field: []*descriptorpb.FieldDescriptorProto{tags},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+			Path:             []int32{4, 0},
+			Span:             []int32{0, 0, 0},
+			TrailingComments: proto.String(" @feature:\"keeper=account\"\n"),
+		}}},
+	})
+	messages := gen.Files[len(gen.Files)-1].Messages
+
+	fields, err := encryptedFields(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range fields {
+		got = append(got, string(f.field.Desc.Name())+"="+f.key)
+	}
+	if fmt.Sprint(got) != "[iban=account document=documents]" {
+		t.Errorf("encryptedFields(Account) = %v", got)
+	}
+	for _, msg := range messages[1:] {
+		if _, err := encryptedFields(msg); err == nil {
+			t.Errorf("encryptedFields(%s) succeeded", msg.Desc.Name())
+		}
+	}
+}
+
+func TestKeeperSettings(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		gen := newTestFilePlugin(t, &descriptorpb.FileDescriptorProto{
+			MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Entity")}},
+			SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:             []int32{4, 0},
+				Span:             []int32{0, 0, 0},
+				TrailingComments: proto.String(" @feature:\"keeper=entity\"\n"),
+			}}},
+		})
+		content, err := generateHelpers(gen, gen.Files[len(gen.Files)-1], settings{pkgs: newPackages("", "example.com/internal/keeper", "", ""), legacyKeeper: legacy}).Content()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "keeper.Keeper) error {\n\treturn keepr.TransitEncrypt(ctx, x, \"entity\")\n}"
+		if legacy {
+			want = "keeper.Keeper) {\n\tkeepr.TransitEncrypt(ctx, x, \"entity\")\n}"
+		}
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("legacyKeeper %v: generated code lacks %q:\n%s", legacy, want, content)
+		}
 	}
 }
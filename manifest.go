@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// manifest lists the helpers generated for a proto file, so that changes of
+// the generated surface show up in a diff.
+type manifest struct {
+	File      string            `json:"file"`
+	Messages  []manifestMessage `json:"messages"`
+	Functions []string          `json:"functions,omitempty"`
+}
+
+type manifestMessage struct {
+	Name       string              `json:"name"`
+	Parser     json.RawMessage     `json:"parser,omitempty"`
+	Directives []manifestDirective `json:"directives,omitempty"`
+	Fields     []manifestField     `json:"fields,omitempty"`
+	Methods    []string            `json:"methods,omitempty"`
+}
+
+type manifestField struct {
+	Name       string              `json:"name"`
+	Source     string              `json:"source,omitempty"`
+	Param      string              `json:"param,omitempty"`
+	Option     json.RawMessage     `json:"option,omitempty"`
+	Directives []manifestDirective `json:"directives,omitempty"`
+	Validate   []string            `json:"validate,omitempty"`
+}
+
+type manifestDirective struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func manifestDirectives(comments protogen.CommentSet) []manifestDirective {
+	var list []manifestDirective
+	for _, directive := range commentDirectives(comments) {
+		list = append(list, manifestDirective{Name: directive.name, Value: directive.value})
+	}
+	return list
+}
+
+// manifestOption returns the JSON of an option, or nil if it is empty.
+// protojson output is compacted, as its whitespace is unstable by design.
+func manifestOption(option proto.Message) (json.RawMessage, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(option)
+	if err != nil || bytes.Equal(data, []byte("{}")) {
+		return nil, err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// generatedFuncs returns the exported methods of each receiver type and the
+// exported functions declared in the Go source content, in order.
+func generatedFuncs(content []byte) (methods map[string][]string, funcs []string, err error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", content, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	methods = map[string][]string{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !fn.Name.IsExported() {
+			continue
+		}
+		if fn.Recv == nil {
+			funcs = append(funcs, fn.Name.Name)
+			continue
+		}
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if ident, ok := recv.(*ast.Ident); ok {
+			methods[ident.Name] = append(methods[ident.Name], fn.Name.Name)
+		}
+	}
+	return methods, funcs, nil
+}
+
+// generateManifest writes the manifest of the helpers generated into g for file
+// to <file>_helpers.manifest.json.
+func generateManifest(gen *protogen.Plugin, file *protogen.File, g *protogen.GeneratedFile) {
+	content, err := g.Content()
+	if err != nil {
+		// The invalid source is reported when the file is written.
+		return
+	}
+	methods, funcs, err := generatedFuncs(content)
+	if err != nil {
+		return
+	}
+
+	m := manifest{File: file.Desc.Path(), Messages: []manifestMessage{}, Functions: funcs}
+	for _, msg := range file.Messages {
+		entry := manifestMessage{
+			Name:       string(msg.Desc.FullName()),
+			Directives: manifestDirectives(msg.Comments),
+			Methods:    methods[msg.GoIdent.GoName],
+		}
+		if entry.Parser, err = manifestOption(parserOption(msg)); err != nil {
+			gen.Error(messageErrorf(msg, "manifest: %v", err))
+			return
+		}
+		for _, field := range msg.Fields {
+			source, param := fieldBinding(field)
+			f := manifestField{
+				Name:       string(field.Desc.Name()),
+				Source:     source,
+				Directives: manifestDirectives(field.Comments),
+			}
+			if source != "" {
+				f.Param = param
+			}
+			if f.Option, err = manifestOption(fieldOption(field)); err != nil {
+				gen.Error(fieldErrorf(field, "manifest: %v", err))
+				return
+			}
+			for _, rule := range validateRules(field) {
+				if rule.value != "" {
+					f.Validate = append(f.Validate, rule.name+"="+rule.value)
+				} else {
+					f.Validate = append(f.Validate, rule.name)
+				}
+			}
+			if f.Source != "" || f.Option != nil || f.Directives != nil || f.Validate != nil {
+				entry.Fields = append(entry.Fields, f)
+			}
+		}
+		m.Messages = append(m.Messages, entry)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		gen.Error(err)
+		return
+	}
+	out := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_helpers.manifest.json", "")
+	out.P(string(data))
+}
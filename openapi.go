@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the documents
+// are written in.
+const openAPIVersion = "3.0.3"
+
+// openAPIDocument is an OpenAPI 3 document describing the messages and routed
+// methods of a proto package.
+type openAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// openAPIPathItem maps lower case HTTP methods to the operations of a path.
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Enum                 []int32                   `json:"enum,omitempty"`
+	EnumNames            []string                  `json:"x-enum-varnames,omitempty"`
+}
+
+// openAPIScalars maps the scalar kinds to their OpenAPI type and format, as
+// the Go structs of the messages are encoded to JSON.
+var openAPIScalars = map[protoreflect.Kind][2]string{
+	protoreflect.BoolKind:     {"boolean", ""},
+	protoreflect.Int32Kind:    {"integer", "int32"},
+	protoreflect.Sint32Kind:   {"integer", "int32"},
+	protoreflect.Sfixed32Kind: {"integer", "int32"},
+	protoreflect.Uint32Kind:   {"integer", "int64"},
+	protoreflect.Fixed32Kind:  {"integer", "int64"},
+	protoreflect.Int64Kind:    {"integer", "int64"},
+	protoreflect.Sint64Kind:   {"integer", "int64"},
+	protoreflect.Sfixed64Kind: {"integer", "int64"},
+	protoreflect.Uint64Kind:   {"integer", "int64"},
+	protoreflect.Fixed64Kind:  {"integer", "int64"},
+	protoreflect.FloatKind:    {"number", "float"},
+	protoreflect.DoubleKind:   {"number", "double"},
+	protoreflect.StringKind:   {"string", ""},
+	protoreflect.BytesKind:    {"string", "byte"},
+}
+
+// openAPIMethods are the HTTP methods an OpenAPI path item may hold.
+var openAPIMethods = map[string]bool{
+	"GET": true, "PUT": true, "POST": true, "DELETE": true,
+	"OPTIONS": true, "HEAD": true, "PATCH": true, "TRACE": true,
+}
+
+// openAPIDescription returns the leading comment of comments without the
+// directive, "In: ..." and "required: true" lines, which are rendered as
+// schema properties instead.
+func openAPIDescription(comments protogen.CommentSet) string {
+	var lines []string
+	for _, line := range strings.Split(string(comments.Leading), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "@") || sourceRegexp.MatchString(line) || line == "required: true" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// openAPIRef returns a reference to the component schema named name.
+func openAPIRef(name protoreflect.FullName) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + string(name)}
+}
+
+// openAPISchemas builds the component schemas of a document, adding the
+// messages and enums referenced by the fields of the added messages.
+type openAPISchemas map[string]*openAPISchema
+
+func (s openAPISchemas) addEnum(enum *protogen.Enum) {
+	name := string(enum.Desc.FullName())
+	if s[name] != nil {
+		return
+	}
+	schema := &openAPISchema{Type: "integer", Format: "int32", Description: openAPIDescription(enum.Comments)}
+	for _, value := range enum.Values {
+		schema.Enum = append(schema.Enum, int32(value.Desc.Number()))
+		schema.EnumNames = append(schema.EnumNames, string(value.Desc.Name()))
+	}
+	s[name] = schema
+}
+
+func (s openAPISchemas) addMessage(msg *protogen.Message) {
+	name := string(msg.Desc.FullName())
+	if s[name] != nil {
+		return
+	}
+	schema := &openAPISchema{Type: "object", Description: openAPIDescription(msg.Comments)}
+	s[name] = schema
+	for _, field := range msg.Fields {
+		if schema.Properties == nil {
+			schema.Properties = map[string]*openAPISchema{}
+		}
+		schema.Properties[string(field.Desc.Name())] = s.field(field)
+		if isRequired(field) {
+			schema.Required = append(schema.Required, string(field.Desc.Name()))
+		}
+	}
+	for _, enum := range msg.Enums {
+		s.addEnum(enum)
+	}
+	for _, nested := range msg.Messages {
+		if !nested.Desc.IsMapEntry() {
+			s.addMessage(nested)
+		}
+	}
+}
+
+// field returns the schema of the values of field, adding the messages and
+// enums it references.
+func (s openAPISchemas) field(field *protogen.Field) *openAPISchema {
+	if field.Desc.IsMap() {
+		schema := &openAPISchema{Type: "object", AdditionalProperties: s.value(field.Message.Fields[1])}
+		schema.Description = openAPIDescription(field.Comments)
+		return schema
+	}
+	schema := s.value(field)
+	if field.Desc.IsList() {
+		schema = &openAPISchema{Type: "array", Items: schema}
+	}
+	if schema.Ref == "" {
+		schema.Description = openAPIDescription(field.Comments)
+	}
+	return schema
+}
+
+// value returns the schema of a single value of field.
+func (s openAPISchemas) value(field *protogen.Field) *openAPISchema {
+	switch {
+	case field.Message != nil:
+		s.addMessage(field.Message)
+		return openAPIRef(field.Message.Desc.FullName())
+	case field.Enum != nil:
+		s.addEnum(field.Enum)
+		return openAPIRef(field.Enum.Desc.FullName())
+	}
+	scalar := openAPIScalars[field.Desc.Kind()]
+	return &openAPISchema{Type: scalar[0], Format: scalar[1]}
+}
+
+// isRequired reports whether field is declared required.
+func isRequired(field *protogen.Field) bool {
+	for _, rule := range validateRules(field) {
+		if rule.name == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// openAPIPath converts a Fiber route path to an OpenAPI path template.
+func openAPIPath(fiberPath string) string {
+	var out strings.Builder
+	for i := 0; i < len(fiberPath); i++ {
+		switch c := fiberPath[i]; {
+		case c == '\\' && i+1 < len(fiberPath):
+			i++
+			out.WriteByte(fiberPath[i])
+		case c == ':':
+			end := i + 1
+			for end < len(fiberPath) && isIdentByte(fiberPath[end]) {
+				end++
+			}
+			out.WriteString("{" + fiberPath[i+1:end] + "}")
+			i = end - 1
+			// Optional parameters are documented as required path
+			// parameters of the path including them.
+			if end < len(fiberPath) && fiberPath[end] == '?' {
+				i++
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// openAPIParameterIn maps the field sources to the parameter locations.
+var openAPIParameterIn = map[string]string{
+	sourcePath:   "path",
+	sourceQuery:  "query",
+	sourceHeader: "header",
+	sourceCookie: "cookie",
+}
+
+// openAPIOperation returns the operation of method bound as BindFromFiber
+// binds its input: the fields bound from the body make up a JSON or, for
+// formData fields, a multipart request body, and context fields are left out.
+func (s openAPISchemas) operation(method *protogen.Method) *openAPIOperation {
+	input := method.Input
+	op := &openAPIOperation{
+		OperationID: method.Parent.GoName + "_" + method.GoName,
+		Tags:        []string{string(method.Parent.Desc.Name())},
+		Description: openAPIDescription(method.Comments),
+		Responses: map[string]openAPIResponse{
+			"200": {
+				Description: string(method.Output.Desc.Name()),
+				Content:     map[string]openAPIMediaType{"application/json": {Schema: openAPIRef(method.Output.Desc.FullName())}},
+			},
+		},
+	}
+	s.addMessage(method.Output)
+
+	body := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	form := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, field := range input.Fields {
+		if isHTTPBody(field) {
+			op.RequestBody = &openAPIRequestBody{
+				Required: isRequired(field),
+				Content:  map[string]openAPIMediaType{"application/json": {Schema: s.field(field)}},
+			}
+			continue
+		}
+		switch source, name := boundBinding(field); source {
+		case sourceBody:
+			body.Properties[string(field.Desc.Name())] = s.field(field)
+			if isRequired(field) {
+				body.Required = append(body.Required, string(field.Desc.Name()))
+			}
+		case sourceFormData:
+			schema := s.field(field)
+			if isUpload(field) {
+				schema = &openAPISchema{Type: "string", Format: "binary", Description: openAPIDescription(field.Comments)}
+			}
+			form.Properties[name] = schema
+			if isRequired(field) {
+				form.Required = append(form.Required, name)
+			}
+		default:
+			in, ok := openAPIParameterIn[source]
+			if !ok || field.Message != nil || isUploadSibling(field) {
+				// Context values and upload names are not part of the
+				// request, and messages and maps are not bound from
+				// parameters.
+				continue
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        name,
+				In:          in,
+				Description: openAPIDescription(field.Comments),
+				Required:    in == "path" || isRequired(field),
+				Schema:      s.field(field),
+			})
+		}
+	}
+	switch {
+	case len(form.Properties) > 0:
+		op.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{"multipart/form-data": {Schema: form}}}
+	case len(body.Properties) > 0 && op.RequestBody == nil:
+		op.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{"application/json": {Schema: body}}}
+	}
+	return op
+}
+
+// generateOpenAPI writes an OpenAPI 3 document per proto package of the files
+// to generate, named <package>.openapi.json and placed next to the helpers of
+// its first file. The document holds a schema for each message and enum of
+// the package and of the types they reference and, when the Fiber routes are
+// generated, an operation for each route of the methods of its services.
+func generateOpenAPI(gen *protogen.Plugin, opts settings) {
+	var order []protoreflect.FullName
+	files := map[protoreflect.FullName][]*protogen.File{}
+	for _, file := range gen.Files {
+		if !file.Generate {
+			continue
+		}
+		pkg := file.Desc.Package()
+		if files[pkg] == nil {
+			order = append(order, pkg)
+		}
+		files[pkg] = append(files[pkg], file)
+	}
+
+	for _, pkg := range order {
+		schemas := openAPISchemas{}
+		doc := openAPIDocument{
+			OpenAPI: openAPIVersion,
+			// protoc knows no version of the API.
+			Info:       openAPIInfo{Title: string(pkg), Version: "1.0.0"},
+			Paths:      map[string]openAPIPathItem{},
+			Components: openAPIComponents{Schemas: schemas},
+		}
+		for _, file := range files[pkg] {
+			for _, enum := range file.Enums {
+				schemas.addEnum(enum)
+			}
+			for _, msg := range file.Messages {
+				schemas.addMessage(msg)
+			}
+			if !opts.fiberBinder {
+				continue
+			}
+			for _, service := range file.Services {
+				for _, method := range service.Methods {
+					routes, err := methodRoutes(method)
+					if err != nil {
+						gen.Error(fmt.Errorf("%s: method %s: %v", file.Desc.Path(), method.Desc.FullName(), err))
+						continue
+					}
+					for i, route := range routes {
+						if !openAPIMethods[route.method] {
+							// Custom HTTP methods cannot be documented.
+							continue
+						}
+						op := schemas.operation(method)
+						if i > 0 {
+							op.OperationID += "_" + strconv.Itoa(i)
+						}
+						p := openAPIPath(route.path)
+						if doc.Paths[p] == nil {
+							doc.Paths[p] = openAPIPathItem{}
+						}
+						doc.Paths[p][strings.ToLower(route.method)] = op
+					}
+				}
+			}
+		}
+
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			gen.Error(fmt.Errorf("OpenAPI document of package %s: %v", pkg, err))
+			continue
+		}
+		dir := path.Dir(files[pkg][0].GeneratedFilenamePrefix)
+		out := gen.NewGeneratedFile(path.Join(dir, string(pkg)+".openapi.json"), "")
+		out.P(string(data))
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/common"
+)
+
+const (
+	optionsPackage = protogen.GoImportPath("go.mongodb.org/mongo-driver/mongo/options")
+	stringsPackage = protogen.GoImportPath("strings")
+)
+
+// projectionFields returns the document keys read by the message named name.
+// For a response declaring @pickFromArrayWPagination these are the fields of
+// its items which are picked from the entity.
+func projectionFields(messages []*protogen.Message, name string) ([]string, error) {
+	var target *protogen.Message
+	for _, msg := range messages {
+		if string(msg.Desc.Name()) == name {
+			target = msg
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("projection message %s not found", name)
+	}
+
+	fields := target.Fields
+	entity, picked := commentDirectives(target.Comments).value("pickFromArrayWPagination")
+	if picked {
+		fields = nil
+		for _, field := range target.Fields {
+			if field.GoName == "Items" && field.Message != nil {
+				fields = field.Message.Fields
+			}
+		}
+	}
+
+	var keys []string
+	for _, field := range fields {
+		if picked && getFieldFromMessage(messages, entity, field.GoName) == nil {
+			continue
+		}
+		keys = append(keys, string(field.Desc.Name()))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("projection message %s has no fields to project", name)
+	}
+	return keys, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type sortKey struct {
+	key       string
+	direction int
+}
+
+// parseSort parses a sort declaration such as "created_at:desc,name".
+func parseSort(sort string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, item := range strings.Split(sort, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, direction, _ := strings.Cut(item, ":")
+		switch strings.ToLower(direction) {
+		case "", "asc":
+			keys = append(keys, sortKey{key: key, direction: 1})
+		case "desc":
+			keys = append(keys, sortKey{key: key, direction: -1})
+		default:
+			return nil, fmt.Errorf("invalid sort direction %q of %s", direction, key)
+		}
+	}
+	return keys, nil
+}
+
+// sortFields returns the sort_by and sort_order fields of msg which let a
+// client pick the sort among the sortable fields of the parser option.
+func sortFields(msg *protogen.Message) (sortBy, sortOrder *protogen.Field) {
+	for _, field := range msg.Fields {
+		if field.Desc.Kind() != protoreflect.StringKind || field.Desc.IsList() {
+			continue
+		}
+		switch field.Desc.Name() {
+		case "sort_by":
+			sortBy = field
+		case "sort_order":
+			sortOrder = field
+		}
+	}
+	return sortBy, sortOrder
+}
+
+// sortDocument returns a bson.D literal sorting by keys, with _id appended as
+// a tie-breaker so that the order of equal keys is deterministic.
+func sortDocument(g *protogen.GeneratedFile, keys []sortKey) string {
+	var elems []string
+	hasID := false
+	for _, key := range keys {
+		elems = append(elems, "{Key: "+strconv.Quote(key.key)+", Value: "+strconv.Itoa(key.direction)+"}")
+		hasID = hasID || key.key == "_id"
+	}
+	if !hasID {
+		elems = append(elems, "{Key: \"_id\", Value: 1}")
+	}
+	return g.QualifiedGoIdent(bsonPackage.Ident("D")) + "{" + strings.Join(elems, ", ") + "}"
+}
+
+// pagingFields returns the integer limit and skip fields of a paged request.
+func pagingFields(msg *protogen.Message) (limit, skip *protogen.Field) {
+	for _, field := range msg.Fields {
+		if !isNumeric(field) || isFloat(field) {
+			continue
+		}
+		switch field.Desc.Name() {
+		case "limit":
+			limit = field
+		case "skip":
+			skip = field
+		}
+	}
+	return limit, skip
+}
+
+// int64Value returns the Go expression reading field of x as an int64.
+func int64Value(field *protogen.Field) string {
+	switch field.Desc.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "x.Get" + field.GoName + "()"
+	}
+	return "int64(x.Get" + field.GoName + "())"
+}
+
+func generatePageLimit(g *protogen.GeneratedFile, msg *protogen.Message, parser *common.ParserOption) {
+	limit, _ := pagingFields(msg)
+	defaultLimit := parser.GetDefaultLimit()
+	if defaultLimit <= 0 {
+		defaultLimit = 20
+	}
+	if parser.GetMaxLimit() > 0 && defaultLimit > parser.GetMaxLimit() {
+		defaultLimit = parser.GetMaxLimit()
+	}
+
+	g.P()
+	g.P("// pageLimit returns the page size applied by GetOptions.")
+	g.P("func (x *", msg.GoIdent, ") pageLimit() int64 {")
+	g.P("limit := ", int64Value(limit))
+	g.P("if limit <= 0 {")
+	g.P("return ", defaultLimit)
+	g.P("}")
+	if parser.GetMaxLimit() > 0 {
+		g.P("if limit > ", parser.GetMaxLimit(), " {")
+		g.P("return ", parser.GetMaxLimit())
+		g.P("}")
+	}
+	g.P("return limit")
+	g.P("}")
+}
+
+func generatePaging(g *protogen.GeneratedFile, msg *protogen.Message, commonPackage protogen.GoImportPath) {
+	_, skip := pagingFields(msg)
+
+	g.P()
+	g.P("// pageSkip returns the number of skipped items applied by GetOptions.")
+	g.P("func (x *", msg.GoIdent, ") pageSkip() int64 {")
+	g.P("if skip := ", int64Value(skip), "; skip > 0 {")
+	g.P("return skip")
+	g.P("}")
+	g.P("return 0")
+	g.P("}")
+	g.P()
+	g.P("// GetPagination returns the pagination of a page fetched with GetOptions out of")
+	g.P("// total matching items.")
+	g.P("func (x *", msg.GoIdent, ") GetPagination(total int64) *", commonPackage.Ident("Pagination"), " {")
+	g.P("return &", commonPackage.Ident("Pagination"), "{")
+	g.P("Limit: x.pageLimit(),")
+	g.P("Skip: x.pageSkip(),")
+	g.P("TotalItems: total,")
+	g.P("}")
+	g.P("}")
+}
+
+func generateProjection(g *protogen.GeneratedFile, msg *protogen.Message, target string, keys []string) {
+	g.P()
+	g.P("// GetProjection returns the projection of the document fields read by ", target, ".")
+	g.P("func (x *", msg.GoIdent, ") GetProjection() ", bsonPackage.Ident("M"), " {")
+	g.P("return ", bsonPackage.Ident("M"), "{")
+	for _, key := range keys {
+		g.P(strconv.Quote(key), ": 1,")
+	}
+	g.P("}")
+	g.P("}")
+}
+
+func generateOptions(gen *protogen.Plugin, g *protogen.GeneratedFile, file *protogen.File, msg *protogen.Message, parser *common.ParserOption, pkgs *packages) {
+	defaultSort, err := parseSort(parser.GetSort())
+	if err != nil {
+		gen.Error(messageErrorf(msg, "%v", err))
+		return
+	}
+	if limit, skip := pagingFields(msg); parser.Paging && (limit == nil || skip == nil) {
+		gen.Error(messageErrorf(msg, "paging needs integer limit and skip fields"))
+		return
+	}
+	if parser.Cursor {
+		if err := checkCursor(msg, parser); err != nil {
+			gen.Error(err)
+			return
+		}
+	}
+	var projection []string
+	if parser.GetProjection() != "" {
+		if projection, err = projectionFields(file.Messages, parser.GetProjection()); err != nil {
+			gen.Error(messageErrorf(msg, "%v", err))
+			return
+		}
+		// NextCursor reads the sort keys from the fetched documents.
+		for _, key := range defaultSort {
+			if parser.Cursor && key.key != "_id" && !contains(projection, key.key) {
+				projection = append(projection, key.key)
+			}
+		}
+	}
+	sortBy, sortOrder := sortFields(msg)
+	if len(parser.GetSortable()) > 0 && sortBy == nil {
+		gen.Error(messageErrorf(msg, "sortable fields need a string sort_by field"))
+		return
+	}
+
+	g.P("func (x *", msg.GoIdent, ") GetOptions() *", optionsPackage.Ident("FindOptions"), " {")
+	g.P("var Options = &", optionsPackage.Ident("FindOptions"), "{}")
+	switch {
+	case parser.Paging:
+		g.P("Options.SetLimit(x.pageLimit())")
+		g.P("Options.SetSkip(x.pageSkip())")
+	case parser.Cursor:
+		g.P("Options.SetLimit(x.pageLimit())")
+		g.P("Options.SetSort(", cursorSort(msg), ")")
+	}
+	if len(parser.GetSortable()) > 0 {
+		var sortable []string
+		sortableID := false
+		for _, key := range parser.GetSortable() {
+			key = strings.TrimSpace(key)
+			if key == "_id" {
+				sortableID = true
+				continue
+			}
+			sortable = append(sortable, strconv.Quote(key))
+		}
+		order := "1"
+		if sortOrder != nil {
+			g.P("order := 1")
+			g.P("if ", stringsPackage.Ident("EqualFold"), "(x.Get", sortOrder.GoName, "(), \"desc\") {")
+			g.P("order = -1")
+			g.P("}")
+			order = "order"
+		}
+		g.P("switch x.Get", sortBy.GoName, "() {")
+		if len(sortable) > 0 {
+			g.P("case ", strings.Join(sortable, ", "), ":")
+			g.P("Options.SetSort(", bsonPackage.Ident("D"), "{{Key: x.Get", sortBy.GoName, "(), Value: ", order, "}, {Key: \"_id\", Value: 1}})")
+		}
+		if sortableID {
+			g.P("case \"_id\":")
+			g.P("Options.SetSort(", bsonPackage.Ident("D"), "{{Key: \"_id\", Value: ", order, "}})")
+		}
+		g.P("default:")
+		g.P("Options.SetSort(", sortDocument(g, defaultSort), ")")
+		g.P("}")
+	} else if !parser.Cursor && (len(defaultSort) > 0 || parser.Paging) {
+		g.P("Options.SetSort(", sortDocument(g, defaultSort), ")")
+	}
+	if projection != nil {
+		g.P("Options.SetProjection(x.GetProjection())")
+	}
+	g.P("return Options")
+	g.P("}")
+
+	if projection != nil {
+		generateProjection(g, msg, parser.GetProjection(), projection)
+	}
+
+	switch {
+	case parser.Paging:
+		generatePageLimit(g, msg, parser)
+		commonPackage, err := pkgs.common()
+		if err != nil {
+			gen.Error(messageErrorf(msg, "%v", err))
+			return
+		}
+		generatePaging(g, msg, commonPackage)
+	case parser.Cursor:
+		generatePageLimit(g, msg, parser)
+		generateCursor(g, msg, defaultSort)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	grpcCodesPackage  = protogen.GoImportPath("google.golang.org/grpc/codes")
+	grpcStatusPackage = protogen.GoImportPath("google.golang.org/grpc/status")
+)
+
+// httpRuleField is the field number of the google.api.http method option. The
+// option is read from the unknown fields of the method options, so that the
+// plugin does not depend on the generated googleapis packages.
+const httpRuleField = 72295728
+
+// httpRule is a google.api.http rule mapping a method to an HTTP route.
+type httpRule struct {
+	method   string
+	path     string
+	body     string
+	bindings []*httpRule
+}
+
+// httpRuleMethods maps the fields of the pattern of an HttpRule to the HTTP
+// methods they stand for.
+var httpRuleMethods = map[protowire.Number]string{
+	2: "GET",
+	3: "PUT",
+	4: "POST",
+	5: "DELETE",
+	6: "PATCH",
+}
+
+// rangeBytesFields calls f with the number and value of each length-delimited
+// field of the wire encoded message b, skipping the other fields.
+func rangeBytesFields(b []byte, f func(num protowire.Number, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := f(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHTTPRule decodes the wire encoding of a google.api.HttpRule.
+func parseHTTPRule(b []byte) (*httpRule, error) {
+	rule := &httpRule{}
+	err := rangeBytesFields(b, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 2, 3, 4, 5, 6:
+			rule.method, rule.path = httpRuleMethods[num], string(value)
+		case 7:
+			rule.body = string(value)
+		case 8:
+			// A CustomHttpPattern holds the method in kind and the path in path.
+			return rangeBytesFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					rule.method = strings.ToUpper(string(value))
+				case 2:
+					rule.path = string(value)
+				}
+				return nil
+			})
+		case 11:
+			binding, err := parseHTTPRule(value)
+			if err != nil {
+				return err
+			}
+			rule.bindings = append(rule.bindings, binding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// methodHTTPRule returns the google.api.http rule of method, or nil if it has
+// none.
+func methodHTTPRule(method protoreflect.MethodDescriptor) (*httpRule, error) {
+	options, _ := method.Options().(*descriptorpb.MethodOptions)
+	if options == nil {
+		return nil, nil
+	}
+	// Repeated occurrences of a message field are merged, which is what
+	// decoding their concatenation does.
+	var payload []byte
+	found := false
+	err := rangeBytesFields(options.ProtoReflect().GetUnknown(), func(num protowire.Number, value []byte) error {
+		if num == httpRuleField {
+			payload = append(payload, value...)
+			found = true
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return nil, err
+	}
+	return parseHTTPRule(payload)
+}
+
+// route is an HTTP route of a method.
+type route struct {
+	method string
+	path   string
+}
+
+// methodRoutes returns the Fiber routes of method, declared either by a
+// @route:"GET /items/:id" directive in Fiber syntax or by a google.api.http
+// rule and its additional bindings.
+func methodRoutes(method *protogen.Method) ([]route, error) {
+	if value, ok := commentDirectives(method.Comments).value("route"); ok {
+		routeMethod, path, _ := strings.Cut(value, " ")
+		return []route{{method: strings.ToUpper(routeMethod), path: strings.TrimSpace(path)}}, nil
+	}
+	rule, err := methodHTTPRule(method.Desc)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+	var routes []route
+	for _, rule := range append([]*httpRule{rule}, rule.bindings...) {
+		path, err := fiberPath(rule.path)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route{method: rule.method, path: path})
+	}
+	return routes, nil
+}
+
+// templateVariables returns the field paths of the variables of a path
+// template such as "/v1/items/{id}" in order, and the template with each
+// variable replaced by replace(field path).
+func templateVariables(template string, replace func(string) (string, error)) ([]string, string, error) {
+	var names []string
+	var out strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			out.WriteString(template)
+			return names, out.String(), nil
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated variable in path template %q", template)
+		}
+		name, pattern, hasPattern := strings.Cut(template[start+1:start+end], "=")
+		if hasPattern && pattern != "*" {
+			return nil, "", fmt.Errorf("path template variable %s matches %q, only single segments are supported", name, pattern)
+		}
+		replaced, err := replace(name)
+		if err != nil {
+			return nil, "", err
+		}
+		out.WriteString(template[:start])
+		out.WriteString(replaced)
+		names = append(names, name)
+		template = template[start+end+1:]
+	}
+}
+
+// fiberPath converts a google.api.http path template to a Fiber route path.
+func fiberPath(template string) (string, error) {
+	// A custom verb follows the last segment after a colon, which Fiber
+	// reads as a parameter unless escaped.
+	if slash := strings.LastIndexByte(template, '/'); slash >= 0 {
+		last := template[slash:]
+		if colon := strings.LastIndexByte(last, ':'); colon >= 0 && colon > strings.LastIndexByte(last, '}') {
+			template = template[:slash+colon] + "\\" + template[slash+colon:]
+		}
+	}
+	_, path, err := templateVariables(template, func(name string) (string, error) {
+		if strings.Contains(name, ".") {
+			return "", fmt.Errorf("path template variable %s of a nested field is not supported", name)
+		}
+		return ":" + name, nil
+	})
+	return path, err
+}
+
+// fiberMethods maps HTTP methods to the fiber.Router methods registering them.
+var fiberMethods = map[string]string{
+	"GET":    "Get",
+	"HEAD":   "Head",
+	"POST":   "Post",
+	"PUT":    "Put",
+	"DELETE": "Delete",
+	"PATCH":  "Patch",
+}
+
+// grpcHTTPStatuses maps gRPC codes to HTTP statuses the way grpc-gateway does.
+var grpcHTTPStatuses = []struct {
+	code   string
+	status string
+}{
+	{"Canceled", "499"},
+	{"InvalidArgument", "StatusBadRequest"},
+	{"DeadlineExceeded", "StatusGatewayTimeout"},
+	{"NotFound", "StatusNotFound"},
+	{"AlreadyExists", "StatusConflict"},
+	{"PermissionDenied", "StatusForbidden"},
+	{"Unauthenticated", "StatusUnauthorized"},
+	{"ResourceExhausted", "StatusTooManyRequests"},
+	{"FailedPrecondition", "StatusBadRequest"},
+	{"Aborted", "StatusConflict"},
+	{"OutOfRange", "StatusBadRequest"},
+	{"Unimplemented", "StatusNotImplemented"},
+	{"Unavailable", "StatusServiceUnavailable"},
+}
+
+func serviceFiberError(service *protogen.Service) string {
+	return "_" + service.GoName + "_fiberError"
+}
+
+func generateFiberError(g *protogen.GeneratedFile, service *protogen.Service, validation protogen.GoImportPath) {
+	g.P()
+	g.P("// ", serviceFiberError(service), " maps an error returned by the methods of ", service.GoName)
+	g.P("// to a Fiber error with the HTTP status of its gRPC code.")
+	g.P("func ", serviceFiberError(service), "(err error) error {")
+	g.P("var fiberErr *", fiberPackage.Ident("Error"))
+	g.P("if ", errorsPackage.Ident("As"), "(err, &fiberErr) {")
+	g.P("return err")
+	g.P("}")
+	g.P("var violations *", validation.Ident("Error"))
+	g.P("if ", errorsPackage.Ident("As"), "(err, &violations) {")
+	g.P("return ", fiberPackage.Ident("NewError"), "(", fiberPackage.Ident("StatusBadRequest"), ", err.Error())")
+	g.P("}")
+	g.P("st, ok := ", grpcStatusPackage.Ident("FromError"), "(err)")
+	g.P("if !ok {")
+	g.P("return err")
+	g.P("}")
+	g.P("code := ", fiberPackage.Ident("StatusInternalServerError"))
+	g.P("switch st.Code() {")
+	for _, status := range grpcHTTPStatuses {
+		g.P("case ", grpcCodesPackage.Ident(status.code), ":")
+		if _, err := strconv.Atoi(status.status); err == nil {
+			g.P("code = ", status.status)
+		} else {
+			g.P("code = ", fiberPackage.Ident(status.status))
+		}
+	}
+	g.P("}")
+	g.P("return ", fiberPackage.Ident("NewError"), "(code, st.Message())")
+	g.P("}")
+}
+
+// generateRoutes emits for each service of file with routed methods a
+// Register<Service>FiberRoutes function registering a handler per route. The
+// handlers bind the request with BindFromFiber, validate it, call the method
+// of the <Service>Server generated by protoc-gen-go-grpc and send the response
+// as JSON.
+func generateRoutes(gen *protogen.Plugin, g *protogen.GeneratedFile, file *protogen.File, validation protogen.GoImportPath) {
+	for _, service := range file.Services {
+		routes := map[*protogen.Method][]route{}
+		for _, method := range service.Methods {
+			methodRoutes, err := methodRoutes(method)
+			if err != nil {
+				gen.Error(fmt.Errorf("%s: method %s: %v", file.Desc.Path(), method.Desc.FullName(), err))
+				return
+			}
+			if len(methodRoutes) == 0 {
+				continue
+			}
+			if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+				gen.Error(fmt.Errorf("%s: method %s: streaming methods cannot be routed", file.Desc.Path(), method.Desc.FullName()))
+				return
+			}
+			if !parserOption(method.Input).Fiber {
+				gen.Error(fmt.Errorf("%s: method %s: input %s needs the fiber parser", file.Desc.Path(), method.Desc.FullName(), method.Input.Desc.FullName()))
+				return
+			}
+			routes[method] = methodRoutes
+		}
+		if len(routes) == 0 {
+			continue
+		}
+
+		g.P()
+		g.P("// Register", service.GoName, "FiberRoutes registers the routes of the ", service.GoName, " methods on app.")
+		g.P("func Register", service.GoName, "FiberRoutes(app ", fiberPackage.Ident("Router"), ", srv ", service.GoName, "Server) {")
+		for _, method := range service.Methods {
+			for _, route := range routes[method] {
+				if register, ok := fiberMethods[route.method]; ok {
+					g.P("app.", register, "(", strconv.Quote(route.path), ", func(ctx *", fiberPackage.Ident("Ctx"), ") error {")
+				} else {
+					g.P("app.Add(", strconv.Quote(route.method), ", ", strconv.Quote(route.path), ", func(ctx *", fiberPackage.Ident("Ctx"), ") error {")
+				}
+				g.P("req := new(", method.Input.GoIdent, ")")
+				g.P("if err := req.BindFromFiber(ctx); err != nil {")
+				g.P("return err")
+				g.P("}")
+				if hasValidate(method.Input) {
+					g.P("if err := req.Validate(); err != nil {")
+					g.P("return ", fiberPackage.Ident("NewError"), "(", fiberPackage.Ident("StatusBadRequest"), ", err.Error())")
+					g.P("}")
+				}
+				g.P("resp, err := srv.", method.GoName, "(ctx.UserContext(), req)")
+				g.P("if err != nil {")
+				g.P("return ", serviceFiberError(service), "(err)")
+				g.P("}")
+				g.P("return ctx.JSON(resp)")
+				g.P("})")
+			}
+		}
+		g.P("}")
+		generateFiberError(g, service, validation)
+	}
+}
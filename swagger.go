@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+// generateSwagComment emits the description of comments as the doc comment of
+// a wrapper field.
+func generateSwagComment(g *protogen.GeneratedFile, comments protogen.CommentSet) {
+	if description := openAPIDescription(comments); description != "" {
+		for _, line := range strings.Split(description, "\n") {
+			g.P("// ", line)
+		}
+	}
+}
+
+// generateSwagParam emits the wrapper field documenting field as a parameter
+// found in the location in, named name.
+func generateSwagParam(g *protogen.GeneratedFile, field *protogen.Field, in, name string) {
+	generateSwagComment(g, field.Comments)
+	g.P("// in: ", in)
+	if in == sourcePath || isRequired(field) {
+		g.P("// required: true")
+	}
+	typ := goType(g, field)
+	if isUpload(field) {
+		g.P("// swagger:file")
+		typ = g.QualifiedGoIdent(ioPackage.Ident("ReadCloser"))
+	}
+	g.P(field.GoName, " ", typ, " `json:", strconv.Quote(name), "`")
+	g.P()
+}
+
+// generateSwagParameters emits the go-swagger parameters wrapper of msg with a
+// field per parameter BindFromFiber binds, in the location of its source. The
+// fields bound from the body are gathered in the Body field, and the context
+// fields are left out as they are not part of the request.
+func generateSwagParameters(g *protogen.GeneratedFile, msg *protogen.Message) {
+	var body []*protogen.Field
+	g.P("// swagger:parameters ", Camel(msg.GoIdent.GoName), "Wrapper")
+	g.P("// ", msg.GoIdent.GoName, "Wrapper wrapper for ", msg.GoIdent.GoName)
+	g.P("type ", msg.GoIdent.GoName, "Wrapper struct {")
+	for _, field := range msg.Fields {
+		source, name := boundBinding(field)
+		switch {
+		case isHTTPBody(field):
+			generateSwagComment(g, field.Comments)
+			g.P("// in: body")
+			if isRequired(field) {
+				g.P("// required: true")
+			}
+			g.P("Body ", goType(g, field))
+			g.P()
+		case source == sourceBody:
+			body = append(body, field)
+		case source == sourceContext || isUploadSibling(field):
+			// Set by the server, not by the client.
+		case source == sourceQuery && field.Message != nil:
+			// Left to QueryParser, which does not bind messages.
+		default:
+			generateSwagParam(g, field, source, name)
+		}
+	}
+	if len(body) > 0 {
+		g.P("// in: body")
+		g.P("Body struct {")
+		for _, field := range body {
+			generateSwagComment(g, field.Comments)
+			if isRequired(field) {
+				g.P("// required: true")
+			}
+			g.P(field.GoName, " ", goType(g, field), " `json:", strconv.Quote(string(field.Desc.Name())), "`")
+		}
+		g.P("}")
+	}
+	g.P("}")
+}
+
+// generateSwagResponse emits the go-swagger response wrapper of msg, named
+// after it, with the message as its body. The fields bound from headers are
+// documented as the headers of the response as well.
+func generateSwagResponse(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message) {
+	g.P()
+	g.P("// swagger:response ", msg.GoIdent.GoName)
+	g.P("// ", msg.GoIdent.GoName, "ResponseWrapper wrapper for ", msg.GoIdent.GoName)
+	g.P("type ", msg.GoIdent.GoName, "ResponseWrapper struct {")
+	for _, field := range msg.Fields {
+		source, name := fieldBinding(field)
+		if source != sourceHeader {
+			continue
+		}
+		if field.Message != nil || field.Desc.IsMap() {
+			gen.Error(fieldErrorf(field, "%s field cannot be a response header", fieldKind(field)))
+			continue
+		}
+		generateSwagComment(g, field.Comments)
+		g.P("// in: header")
+		g.P(field.GoName, " ", goType(g, field), " `json:", strconv.Quote(name), "`")
+		g.P()
+	}
+	g.P("// in: body")
+	g.P("Body *", msg.GoIdent.GoName)
+	g.P("}")
+}
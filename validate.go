@@ -0,0 +1,357 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	regexpPackage = protogen.GoImportPath("regexp")
+	utf8Package   = protogen.GoImportPath("unicode/utf8")
+	// defaultValidationPackage is the validation package of the plugin, which
+	// the generated code imports unless validation_package names a copy.
+	defaultValidationPackage = protogen.GoImportPath("gitlab.cryptojeton.shop/crypterium/protoc-gen-go-helpers/validation")
+)
+
+type validateRule struct {
+	name  string
+	value string
+}
+
+// validateRules returns the rules declared for field by the is_required and
+// validate field options and by a "required: true" leading comment, plus the
+// allow-list of sortable fields for a sort_by field and the check of a cursor
+// field. The validate option is a comma separated list of rules, e.g.
+// "required,min=3". A pattern rule takes the rest of the list, so it may
+// contain commas.
+//
+// Only the required rule applies to empty values, which the other rules skip.
+// As proto3 does not tell an unset bool or enum from false or the zero value,
+// a required bool must be true and a required enum must not be zero.
+func validateRules(field *protogen.Field) []validateRule {
+	option := fieldOption(field)
+
+	var rules []validateRule
+	required := option.GetIsRequired() || strings.Contains(string(field.Comments.Leading), "required: true")
+	if required {
+		rules = append(rules, validateRule{name: "required"})
+	}
+	for list := option.GetValidate(); list != ""; {
+		rule := list
+		list = ""
+		if !strings.HasPrefix(strings.TrimSpace(rule), "pattern=") {
+			rule, list, _ = strings.Cut(rule, ",")
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" || (name == "required" && required) {
+			continue
+		}
+		rules = append(rules, validateRule{name: name, value: value})
+	}
+	if field.Parent != nil && len(parserOption(field.Parent).GetSortable()) > 0 {
+		if sortBy, _ := sortFields(field.Parent); sortBy == field {
+			rules = append(rules, validateRule{name: "sortable", value: strings.Join(parserOption(field.Parent).GetSortable(), "|")})
+		}
+	}
+	return append(rules, cursorRule(field)...)
+}
+
+// validatesNested reports whether the message stored in field has rules of its
+// own, directly or through its message fields.
+func validatesNested(field *protogen.Field, seen map[*protogen.Message]bool) bool {
+	msg := field.Message
+	if field.Desc.IsMap() {
+		msg = field.Message.Fields[1].Message
+	}
+	if msg == nil || seen[msg] {
+		return false
+	}
+	seen[msg] = true
+	for _, nested := range msg.Fields {
+		if len(validateRules(nested)) > 0 || validatesNested(nested, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// lengthOf returns the Go expression measuring the length of field, or an
+// empty string when the field has no length.
+func lengthOf(g *protogen.GeneratedFile, field *protogen.Field) string {
+	getter := "x.Get" + field.GoName + "()"
+	switch {
+	case field.Desc.IsList() || field.Desc.IsMap():
+		return "len(" + getter + ")"
+	case field.Desc.Kind() == protoreflect.StringKind:
+		return g.QualifiedGoIdent(utf8Package.Ident("RuneCountInString")) + "(" + getter + ")"
+	case field.Desc.Kind() == protoreflect.BytesKind:
+		return "len(" + getter + ")"
+	}
+	return ""
+}
+
+func isNumeric(field *protogen.Field) bool {
+	if field.Desc.IsList() || field.Desc.IsMap() {
+		return false
+	}
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind, protoreflect.StringKind, protoreflect.BytesKind,
+		protoreflect.EnumKind, protoreflect.MessageKind, protoreflect.GroupKind:
+		return false
+	}
+	return true
+}
+
+func isFloat(field *protogen.Field) bool {
+	return isNumeric(field) && (field.Desc.Kind() == protoreflect.FloatKind || field.Desc.Kind() == protoreflect.DoubleKind)
+}
+
+// parseNumber reports whether value is a valid literal for the numeric field.
+func parseNumber(field *protogen.Field, value string) bool {
+	var err error
+	switch kind := field.Desc.Kind().String(); {
+	case isFloat(field):
+		_, err = strconv.ParseFloat(value, 64)
+	case strings.HasPrefix(kind, "uint") || strings.HasPrefix(kind, "fixed"):
+		_, err = strconv.ParseUint(value, 10, 64)
+	default:
+		_, err = strconv.ParseInt(value, 10, 64)
+	}
+	return err == nil
+}
+
+// comparisons maps the comparison rules to the operator which detects a
+// violation and to the description of the violation.
+var comparisons = map[string]struct {
+	operator    string
+	description string
+}{
+	"min": {"<", "must be at least "},
+	"gte": {"<", "must be at least "},
+	"max": {">", "must be at most "},
+	"lte": {">", "must be at most "},
+	"gt":  {"<=", "must be greater than "},
+	"lt":  {">=", "must be less than "},
+	"len": {"!=", "must be exactly "},
+}
+
+const uuidPattern = "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
+
+// hasValidate reports whether a Validate method is generated for msg.
+func hasValidate(msg *protogen.Message) bool {
+	for _, field := range msg.Fields {
+		if len(validateRules(field)) > 0 || validatesNested(field, map[*protogen.Message]bool{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateValidate emits the Validate methods of msg and of the messages nested
+// in it, reporting violations with the Error type of the validation package.
+func generateValidate(gen *protogen.Plugin, g *protogen.GeneratedFile, msg *protogen.Message, validation protogen.GoImportPath) {
+	for _, nested := range msg.Messages {
+		if !nested.Desc.IsMapEntry() {
+			generateValidate(gen, g, nested, validation)
+		}
+	}
+	if !hasValidate(msg) {
+		return
+	}
+
+	for _, field := range msg.Fields {
+		for _, rule := range validateRules(field) {
+			if rule.name == "uuid" {
+				g.P()
+				g.P("var _", msg.GoIdent.GoName, "_", field.GoName, "_uuid = ", regexpPackage.Ident("MustCompile"), "(", strconv.Quote(uuidPattern), ")")
+			}
+			if rule.name != "pattern" {
+				continue
+			}
+			if _, err := regexp.Compile(rule.value); err != nil {
+				gen.Error(fieldErrorf(field, "invalid validate pattern: %v", err))
+				return
+			}
+			g.P()
+			g.P("var _", msg.GoIdent.GoName, "_", field.GoName, "_pattern = ", regexpPackage.Ident("MustCompile"), "(", strconv.Quote(rule.value), ")")
+		}
+	}
+
+	g.P()
+	g.P("// Validate checks x against the rules declared on its fields and returns a")
+	g.P("// validation.Error listing every violating field.")
+	g.P("func (x *", msg.GoIdent, ") Validate() error {")
+	g.P("if x == nil { return nil }")
+	g.P("errs := new(", validation.Ident("Error"), ")")
+	for _, field := range msg.Fields {
+		name := string(field.Desc.Name())
+		getter := "x.Get" + field.GoName + "()"
+		violation := func(cond string, description string) {
+			g.P("if ", cond, " {")
+			g.P("errs.Add(", strconv.Quote(name), ", ", strconv.Quote(description), ")")
+			g.P("}")
+		}
+		unsupported := func(rule validateRule) {
+			gen.Error(fieldErrorf(field, "validate rule %s is not supported for %s fields", rule.name, field.Desc.Kind()))
+		}
+
+		required := false
+		var rules []validateRule
+		for _, rule := range validateRules(field) {
+			if rule.name == "required" {
+				required = true
+			} else {
+				rules = append(rules, rule)
+			}
+		}
+		switch {
+		case !required:
+		case field.Desc.Kind() == protoreflect.BoolKind && !field.Desc.IsList() && !field.Desc.HasOptionalKeyword():
+			violation(zeroCheck(field, "x"), "must be true")
+		default:
+			violation(zeroCheck(field, "x"), "is required")
+		}
+		if len(rules) > 0 {
+			g.P("if ", nonZeroCheck(field, "x"), " {")
+		}
+		for _, rule := range rules {
+			switch rule.name {
+			case "min", "max", "gt", "gte", "lt", "lte", "len":
+				comparison := comparisons[rule.name]
+				switch length := lengthOf(g, field); {
+				case length != "":
+					if _, err := strconv.ParseUint(rule.value, 10, 31); err != nil {
+						gen.Error(fieldErrorf(field, "invalid value %q for validate rule %s", rule.value, rule.name))
+						return
+					}
+					violation(length+" "+comparison.operator+" "+rule.value, "length "+comparison.description+rule.value)
+				case isNumeric(field):
+					if !parseNumber(field, rule.value) {
+						gen.Error(fieldErrorf(field, "invalid value %q for validate rule %s", rule.value, rule.name))
+						return
+					}
+					violation(getter+" "+comparison.operator+" "+rule.value, comparison.description+rule.value)
+				default:
+					unsupported(rule)
+					return
+				}
+			case "pattern":
+				if field.Desc.Kind() != protoreflect.StringKind || field.Desc.IsList() || field.Desc.IsMap() {
+					unsupported(rule)
+					return
+				}
+				violation("!_"+msg.GoIdent.GoName+"_"+field.GoName+"_pattern.MatchString("+getter+")", "must match "+rule.value)
+			case "uuid":
+				if field.Desc.Kind() != protoreflect.StringKind || field.Desc.IsList() || field.Desc.IsMap() {
+					unsupported(rule)
+					return
+				}
+				violation("!_"+msg.GoIdent.GoName+"_"+field.GoName+"_uuid.MatchString("+getter+")", "must be a UUID")
+			case "in":
+				if field.Desc.IsList() || field.Desc.IsMap() {
+					unsupported(rule)
+					return
+				}
+				values := strings.Split(rule.value, "|")
+				var conds []string
+				for _, value := range values {
+					switch {
+					case field.Enum != nil:
+						enumValue := enumValueByName(field.Enum, value)
+						if enumValue == nil {
+							gen.Error(fieldErrorf(field, "%s is not a value of %s", value, field.Enum.Desc.FullName()))
+							return
+						}
+						conds = append(conds, getter+" != "+g.QualifiedGoIdent(enumValue.GoIdent))
+					case field.Desc.Kind() == protoreflect.StringKind:
+						conds = append(conds, getter+" != "+strconv.Quote(value))
+					case isNumeric(field) && parseNumber(field, value):
+						conds = append(conds, getter+" != "+value)
+					default:
+						gen.Error(fieldErrorf(field, "invalid value %q for validate rule %s", value, rule.name))
+						return
+					}
+				}
+				violation(strings.Join(conds, " && "), "must be one of "+strings.Join(values, ", "))
+			case "sortable":
+				if field.Desc.Kind() != protoreflect.StringKind || field.Desc.IsList() || field.Desc.IsMap() {
+					unsupported(rule)
+					return
+				}
+				values := strings.Split(rule.value, "|")
+				var conds []string
+				for _, value := range values {
+					conds = append(conds, getter+" != "+strconv.Quote(strings.TrimSpace(value)))
+				}
+				violation(strings.Join(conds, " && "), "must be one of "+strings.Join(values, ", "))
+			case "cursor":
+				violation("_, err := x.cursorValues(); err != nil", "is invalid")
+			case "enum":
+				if field.Enum == nil || field.Desc.IsMap() {
+					unsupported(rule)
+					return
+				}
+				names := g.QualifiedGoIdent(protogen.GoIdent{GoName: field.Enum.GoIdent.GoName + "_name", GoImportPath: field.Enum.GoIdent.GoImportPath})
+				if field.Desc.IsList() {
+					g.P("for i, value := range ", getter, " {")
+					g.P("if _, ok := ", names, "[int32(value)]; !ok {")
+					g.P("errs.Add(", fmtPackage.Ident("Sprintf"), "(\"", name, "[%d]\", i), \"must be a defined enum value\")")
+					g.P("}")
+					g.P("}")
+					continue
+				}
+				violation("_, ok := "+names+"[int32("+getter+")]; !ok", "must be a defined enum value")
+			default:
+				gen.Error(fieldErrorf(field, "unknown validate rule %q", rule.name))
+				return
+			}
+		}
+		if len(rules) > 0 {
+			g.P("}")
+		}
+
+		if !validatesNested(field, map[*protogen.Message]bool{}) {
+			continue
+		}
+		const validator = "interface{ Validate() error }"
+		switch {
+		case field.Desc.IsList():
+			g.P("for i, item := range ", getter, " {")
+			g.P("if v, ok := interface{}(item).(", validator, "); ok {")
+			g.P("if err := v.Validate(); err != nil {")
+			g.P("errs.AddNested(", fmtPackage.Ident("Sprintf"), "(\"", name, "[%d]\", i), err)")
+			g.P("}")
+			g.P("}")
+			g.P("}")
+		case field.Desc.IsMap():
+			g.P("for key, item := range ", getter, " {")
+			g.P("if v, ok := interface{}(item).(", validator, "); ok {")
+			g.P("if err := v.Validate(); err != nil {")
+			g.P("errs.AddNested(", fmtPackage.Ident("Sprintf"), "(\"", name, "[%v]\", key), err)")
+			g.P("}")
+			g.P("}")
+			g.P("}")
+		default:
+			g.P("if v, ok := interface{}(", getter, ").(", validator, "); ok {")
+			g.P("if err := v.Validate(); err != nil {")
+			g.P("errs.AddNested(", strconv.Quote(name), ", err)")
+			g.P("}")
+			g.P("}")
+		}
+	}
+	g.P("return errs.Err()")
+	g.P("}")
+}
+
+func enumValueByName(enum *protogen.Enum, name string) *protogen.EnumValue {
+	for _, value := range enum.Values {
+		if string(value.Desc.Name()) == name {
+			return value
+		}
+	}
+	return nil
+}
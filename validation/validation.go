@@ -0,0 +1,71 @@
+// Package validation holds the types used by the generated Validate methods.
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+// ContextKey is the type of the keys of the context values read by the
+// generated BindFromHTTP methods, which a middleware stores as in
+// context.WithValue(ctx, validation.ContextKey("user_id"), id).
+type ContextKey string
+
+// FieldViolation describes a single field which failed validation.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// Error is returned by the generated Validate methods and lists every
+// violating field path.
+type Error struct {
+	Violations []FieldViolation `json:"violations"`
+}
+
+// NewError returns an Error holding the violation of field, which is empty
+// for violations of the request as a whole.
+func NewError(field, description string) *Error {
+	return &Error{Violations: []FieldViolation{{Field: field, Description: description}}}
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	for i, violation := range e.Violations {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		if violation.Field != "" {
+			b.WriteString(violation.Field)
+			b.WriteString(": ")
+		}
+		b.WriteString(violation.Description)
+	}
+	return b.String()
+}
+
+// Add records a violation of field.
+func (e *Error) Add(field, description string) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Description: description})
+}
+
+// AddNested records the error returned by the Validate method of the nested
+// message stored in field, prefixing the paths of its violations with field.
+func (e *Error) AddNested(field string, err error) {
+	var nested *Error
+	if !errors.As(err, &nested) {
+		e.Add(field, err.Error())
+		return
+	}
+	for _, violation := range nested.Violations {
+		e.Add(field+"."+violation.Field, violation.Description)
+	}
+}
+
+// Err returns e when it holds violations and nil otherwise.
+func (e *Error) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	errs := new(Error)
+	if errs.Err() != nil {
+		t.Fatal("Err() of an empty Error is not nil")
+	}
+
+	nested := new(Error)
+	nested.Add("city", "is required")
+	errs.Add("name", "is required")
+	errs.AddNested("address", nested)
+	errs.AddNested("items[0]", errors.New("broken"))
+
+	want := "name: is required; address.city: is required; items[0]: broken"
+	if err := errs.Err(); err == nil || err.Error() != want {
+		t.Errorf("Err() = %v, want %s", err, want)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	if got, want := NewError("id", "invalid").Error(), "id: invalid"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := NewError("", "invalid body").Error(), "invalid body"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}